@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"goproject/pkg/data"
+)
+
+type envelope map[string]interface{}
+
+// render writes env as JSON when -output=json, and otherwise writes the rows
+// as an aligned table under header.
+func (app *application) render(env envelope, header []string, rows [][]string) error {
+	if app.config.output == "json" {
+		enc := json.NewEncoder(app.stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(env)
+	}
+
+	tw := tabwriter.NewWriter(app.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// newFlagSet returns a flag set for a command's own flags, which come before
+// its arguments.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// lookupUser finds a user by id or email address.
+func (app *application) lookupUser(ctx context.Context, ref string) (*data.User, error) {
+	var (
+		user *data.User
+		err  error
+	)
+
+	if id, convErr := strconv.ParseInt(ref, 10, 64); convErr == nil {
+		user, err = app.models.Users.Get(ctx, id)
+	} else {
+		user, err = app.models.Users.GetByEmail(ctx, ref)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, fmt.Errorf("no user %q", ref)
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// splitCodes parses a comma-separated list of permission codes.
+func splitCodes(s string) []string {
+	var codes []string
+	for _, code := range strings.Split(s, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// checkCodes makes sure every code is a known permission, since granting an
+// unknown one would silently do nothing.
+func (app *application) checkCodes(ctx context.Context, codes []string) error {
+	known, err := app.models.Permissions.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if !known.Include(code) {
+			return fmt.Errorf("unknown permission %q (known: %s)", code, strings.Join(known, ", "))
+		}
+	}
+
+	return nil
+}
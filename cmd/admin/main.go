@@ -0,0 +1,153 @@
+// Command admin manages users, permissions and tokens directly in the
+// database, for jobs such as granting characters:write to a teammate, and
+// seeds development databases.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"goproject/pkg/data"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: admin [flags] <command> [arguments]
+
+commands:
+  users list
+  users create [-activated=true] [-permissions codes] -name NAME -email EMAIL (-password PASSWORD | -password-stdin)
+  users activate USER
+  permissions list [USER]
+  permissions grant USER CODE...
+  permissions revoke USER CODE...
+  tokens issue [-ttl 24h] USER
+  api-keys create [-ttl 0] [-permissions codes] -name NAME USER
+  seed [-players N]
+
+USER is an email address or a user id.
+
+flags:
+`
+
+type config struct {
+	dsn          string
+	queryTimeout time.Duration
+	output       string
+}
+
+type application struct {
+	config config
+	models data.Models
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func main() {
+	var cfg config
+	var envFile string
+	flag.StringVar(&envFile, "env-file", ".env", "File of KEY=value lines to load into the environment, if it exists")
+	flag.StringVar(&cfg.dsn, "db-dsn", "", "PostgreSQL DSN (defaults to $DB_DSN)")
+	flag.DurationVar(&cfg.queryTimeout, "db-query-timeout", data.DefaultQueryTimeout, "Timeout for each database operation")
+	flag.StringVar(&cfg.output, "output", "table", "Output format (table|json)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	err := run(cfg, envFile, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg config, envFile string, args []string) error {
+	if len(args) == 0 || (args[0] != "seed" && len(args) < 2) {
+		flag.Usage()
+		return errors.New("missing command")
+	}
+	if cfg.output != "table" && cfg.output != "json" {
+		return fmt.Errorf("invalid output format %q", cfg.output)
+	}
+
+	err := godotenv.Load(envFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("loading %s: %w", envFile, err)
+	}
+	if cfg.dsn == "" {
+		cfg.dsn = os.Getenv("DB_DSN")
+	}
+	if cfg.dsn == "" {
+		return errors.New("no database DSN: set -db-dsn or DB_DSN")
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	app := &application{
+		config: cfg,
+		models: data.NewModels(db, cfg.queryTimeout),
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+	}
+
+	ctx := context.Background()
+
+	if args[0] == "seed" {
+		return app.seedDatabase(ctx, args[1:])
+	}
+	switch command, args := args[0]+" "+args[1], args[2:]; command {
+	case "users list":
+		return app.listUsers(ctx, args)
+	case "users create":
+		return app.createUser(ctx, args)
+	case "users activate":
+		return app.activateUser(ctx, args)
+	case "permissions list":
+		return app.listPermissions(ctx, args)
+	case "permissions grant":
+		return app.grantPermissions(ctx, args)
+	case "permissions revoke":
+		return app.revokePermissions(ctx, args)
+	case "tokens issue":
+		return app.issueToken(ctx, args)
+	case "api-keys create":
+		return app.createAPIKey(ctx, args)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func openDB(cfg config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
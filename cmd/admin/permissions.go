@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"goproject/pkg/data"
+)
+
+// listPermissions lists a user's permissions, or every known permission when
+// no user is given.
+func (app *application) listPermissions(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		permissions, err := app.models.Permissions.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		return app.renderCodes(permissions)
+	case 1:
+		user, err := app.lookupUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		permissions, err := app.models.Permissions.GetAllForUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return app.renderUser(user, permissions)
+	default:
+		return errors.New("usage: permissions list [USER]")
+	}
+}
+
+func (app *application) grantPermissions(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: permissions grant USER CODE...")
+	}
+
+	user, err := app.lookupUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	codes := args[1:]
+	err = app.checkCodes(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	var held data.Permissions
+	var added []string
+
+	err = app.models.WithTx(ctx, func(tx data.Models) error {
+		var err error
+		held, err = tx.Permissions.GetAllForUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		added = nil
+		for _, code := range codes {
+			if !held.Include(code) && !data.Permissions(added).Include(code) {
+				added = append(added, code)
+			}
+		}
+
+		if len(added) == 0 {
+			return nil
+		}
+
+		err = tx.Permissions.AddForUser(ctx, user.ID, added...)
+		if err != nil {
+			return err
+		}
+
+		return audit(ctx, tx, data.AuditPermissionGrant, user, added)
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.renderUser(user, append(held, added...))
+}
+
+func (app *application) revokePermissions(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: permissions revoke USER CODE...")
+	}
+
+	user, err := app.lookupUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	codes := args[1:]
+	err = app.checkCodes(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	var remaining data.Permissions
+
+	err = app.models.WithTx(ctx, func(tx data.Models) error {
+		held, err := tx.Permissions.GetAllForUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		removed = nil
+		remaining = data.Permissions{}
+		for _, code := range held {
+			if data.Permissions(codes).Include(code) {
+				removed = append(removed, code)
+			} else {
+				remaining = append(remaining, code)
+			}
+		}
+
+		if len(removed) == 0 {
+			return nil
+		}
+
+		err = tx.Permissions.RemoveForUser(ctx, user.ID, removed...)
+		if err != nil {
+			return err
+		}
+
+		return audit(ctx, tx, data.AuditPermissionRevoke, user, removed)
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.renderUser(user, remaining)
+}
+
+func audit(ctx context.Context, models data.Models, event string, user *data.User, codes []string) error {
+	return models.Audit.Insert(ctx, &data.AuditEvent{
+		Event:  event,
+		UserID: &user.ID,
+		Details: map[string]string{
+			"codes":  strings.Join(codes, ","),
+			"source": "admin",
+		},
+	})
+}
+
+func (app *application) renderCodes(permissions data.Permissions) error {
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	rows := make([][]string, len(permissions))
+	for i, code := range permissions {
+		rows[i] = []string{code}
+	}
+
+	return app.render(envelope{"permissions": permissions}, []string{"CODE"}, rows)
+}
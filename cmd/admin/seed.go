@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"goproject/pkg/seed"
+)
+
+// seedDatabase upserts the bundled heroes, and optionally synthetic players.
+// It is safe to run again after the dataset is updated for a new patch.
+func (app *application) seedDatabase(ctx context.Context, args []string) error {
+	var players int
+
+	fs := newFlagSet("seed")
+	fs.IntVar(&players, "players", 0, "")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 0 || players < 0 {
+		return errors.New("usage: seed [-players N]")
+	}
+
+	dataset, err := seed.Heroes()
+	if err != nil {
+		return err
+	}
+
+	heroes, err := seed.Characters(ctx, app.models, dataset.Heroes)
+	if err != nil {
+		return err
+	}
+
+	env := envelope{"version": dataset.Version, "patch": dataset.Patch, "characters": heroes}
+	rows := [][]string{resultRow("characters", heroes)}
+
+	if players > 0 {
+		result, err := seed.Players(ctx, app.models, players)
+		if err != nil {
+			return err
+		}
+
+		env["players"] = result
+		rows = append(rows, resultRow("players", result))
+	}
+
+	return app.render(env, []string{"TABLE", "INSERTED", "UPDATED", "UNCHANGED"}, rows)
+}
+
+func resultRow(table string, result seed.Result) []string {
+	return []string{
+		table,
+		strconv.Itoa(result.Inserted),
+		strconv.Itoa(result.Updated),
+		strconv.Itoa(result.Unchanged),
+	}
+}
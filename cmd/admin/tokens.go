@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"goproject/pkg/data"
+	"goproject/pkg/validator"
+)
+
+// issueToken creates an authentication token for a user, for scripts which
+// need to call the API as them.
+func (app *application) issueToken(ctx context.Context, args []string) error {
+	var ttl time.Duration
+
+	fs := newFlagSet("tokens issue")
+	fs.DurationVar(&ttl, "ttl", 24*time.Hour, "")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 1 || ttl <= 0 {
+		return errors.New("usage: tokens issue [-ttl 24h] USER")
+	}
+
+	user, err := app.lookupUser(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !user.Activated {
+		return errors.New("the user must be activated first")
+	}
+
+	token, err := app.models.Tokens.New(ctx, user.ID, ttl, data.ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	row := []string{token.Plaintext, token.Expiry.UTC().Format(time.RFC3339)}
+
+	return app.render(envelope{"authentication_token": token}, []string{"TOKEN", "EXPIRY"}, [][]string{row})
+}
+
+// createAPIKey creates an API key for a user. The key's permissions are
+// still limited to those the user holds when it is used.
+func (app *application) createAPIKey(ctx context.Context, args []string) error {
+	var (
+		name        string
+		permissions string
+		ttl         time.Duration
+	)
+
+	fs := newFlagSet("api-keys create")
+	fs.StringVar(&name, "name", "", "")
+	fs.StringVar(&permissions, "permissions", "", "")
+	fs.DurationVar(&ttl, "ttl", 0, "")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 1 || ttl < 0 {
+		return errors.New("usage: api-keys create [-ttl 0] [-permissions codes] -name NAME USER")
+	}
+
+	user, err := app.lookupUser(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	held, err := app.models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Without -permissions the key gets everything the user holds now.
+	codes := data.Permissions(splitCodes(permissions))
+	if len(codes) == 0 {
+		codes = held
+	}
+	for _, code := range codes {
+		if !held.Include(code) {
+			return fmt.Errorf("the user doesn't have the %q permission", code)
+		}
+	}
+
+	key := &data.APIKey{Name: name, Permissions: codes}
+	if ttl > 0 {
+		expiry := time.Now().Add(ttl)
+		key.Expiry = &expiry
+	}
+
+	v := validator.New()
+	if data.ValidateAPIKey(v, key); !v.Valid() {
+		return validationError(v)
+	}
+
+	key, err = app.models.APIKeys.New(ctx, user.ID, key.Name, key.Permissions, key.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAPIKeyName):
+			return errors.New("the user already has an API key with this name")
+		default:
+			return err
+		}
+	}
+
+	expiry := ""
+	if key.Expiry != nil {
+		expiry = key.Expiry.UTC().Format(time.RFC3339)
+	}
+	row := []string{strconv.FormatInt(key.ID, 10), key.Name, key.Plaintext, strings.Join(key.Permissions, ","), expiry}
+
+	return app.render(envelope{"api_key": key}, []string{"ID", "NAME", "KEY", "PERMISSIONS", "EXPIRY"}, [][]string{row})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goproject/pkg/data"
+	"goproject/pkg/validator"
+)
+
+func (app *application) listUsers(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: users list")
+	}
+
+	users, err := app.models.Users.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(users))
+	for i, user := range users {
+		rows[i] = []string{
+			strconv.FormatInt(user.ID, 10),
+			user.Email,
+			user.Name,
+			strconv.FormatBool(user.Activated),
+			user.CreatedAt.UTC().Format(time.RFC3339),
+		}
+	}
+
+	return app.render(envelope{"users": users}, []string{"ID", "EMAIL", "NAME", "ACTIVATED", "CREATED"}, rows)
+}
+
+func (app *application) createUser(ctx context.Context, args []string) error {
+	var input struct {
+		name          string
+		email         string
+		password      string
+		passwordStdin bool
+		activated     bool
+		permissions   string
+	}
+
+	fs := newFlagSet("users create")
+	fs.StringVar(&input.name, "name", "", "")
+	fs.StringVar(&input.email, "email", "", "")
+	fs.StringVar(&input.password, "password", "", "")
+	fs.BoolVar(&input.passwordStdin, "password-stdin", false, "")
+	fs.BoolVar(&input.activated, "activated", true, "")
+	fs.StringVar(&input.permissions, "permissions", strings.Join(data.DefaultPermissions, ","), "")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 0 {
+		return errors.New("usage: users create [-activated=true] [-permissions codes] -name NAME -email EMAIL (-password PASSWORD | -password-stdin)")
+	}
+
+	if input.passwordStdin {
+		line, err := bufio.NewReader(app.stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading password: %w", err)
+		}
+		input.password = strings.TrimRight(line, "\r\n")
+	}
+
+	user := &data.User{
+		Name:      input.name,
+		Email:     input.email,
+		Activated: input.activated,
+	}
+
+	// bcrypt refuses passwords over 72 bytes, so check the password before
+	// hashing it.
+	v := validator.New()
+	if data.ValidatePasswordPlaintext(v, input.password); !v.Valid() {
+		return validationError(v)
+	}
+
+	err = user.Password.Set(input.password)
+	if err != nil {
+		return err
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v)
+	}
+
+	codes := splitCodes(input.permissions)
+	err = app.checkCodes(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.WithTx(ctx, func(tx data.Models) error {
+		err := tx.Users.Insert(ctx, user)
+		if err != nil || len(codes) == 0 {
+			return err
+		}
+
+		return tx.Permissions.AddForUser(ctx, user.ID, codes...)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			return fmt.Errorf("a user with the email %q already exists", user.Email)
+		default:
+			return err
+		}
+	}
+
+	return app.renderUser(user, codes)
+}
+
+func (app *application) activateUser(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: users activate USER")
+	}
+
+	user, err := app.lookupUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if !user.Activated {
+		user.Activated = true
+
+		err = app.models.Users.Update(ctx, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return errors.New("the user was changed at the same time, please try again")
+			default:
+				return err
+			}
+		}
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.renderUser(user, permissions)
+}
+
+func (app *application) renderUser(user *data.User, permissions data.Permissions) error {
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	row := []string{
+		strconv.FormatInt(user.ID, 10),
+		user.Email,
+		user.Name,
+		strconv.FormatBool(user.Activated),
+		strings.Join(permissions, ","),
+	}
+
+	return app.render(envelope{"user": user, "permissions": permissions}, []string{"ID", "EMAIL", "NAME", "ACTIVATED", "PERMISSIONS"}, [][]string{row})
+}
+
+func validationError(v *validator.Validator) error {
+	messages := make([]string, 0, len(v.Errors))
+	for key, message := range v.Errors {
+		messages = append(messages, key+" "+message)
+	}
+	sort.Strings(messages)
+	return errors.New(strings.Join(messages, "; "))
+}
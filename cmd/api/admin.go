@@ -0,0 +1,56 @@
+package main
+
+import (
+	"goproject/pkg/jsonlog"
+	"goproject/pkg/validator"
+	"net/http"
+	"strings"
+)
+
+func (app *application) showLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	env := envelope{"level": strings.ToLower(app.logger.Level().String())}
+
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateLogLevelHandler changes the log level of the running instance. It
+// isn't persisted, so a restart goes back to -log-level.
+func (app *application) updateLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Level string `json:"level"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	level, err := jsonlog.ParseLevel(input.Level)
+	v.Check(input.Level != "", "level", "must be provided")
+	v.Check(input.Level == "" || err == nil, "level", "must be one of debug, info, warn, error, fatal or off")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	previous := app.logger.Level()
+	app.logger.SetLevel(level)
+
+	app.requestLogger(r).PrintWarn("log level changed", map[string]interface{}{
+		"from":    previous,
+		"to":      level,
+		"user_id": app.contextGetUser(r).ID,
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"level": strings.ToLower(level.String())}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
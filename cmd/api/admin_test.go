@@ -0,0 +1,51 @@
+package main
+
+import (
+	"goproject/pkg/jsonlog"
+	"net/http"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "admin@example.com", "admin:logging")
+
+	res := ts.request(t, http.MethodGet, "/v1/admin/log-level", token, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	var body struct {
+		Level string `json:"level"`
+	}
+	res.decode(t, &body)
+
+	if body.Level != "info" {
+		t.Errorf("got level %q, want info", body.Level)
+	}
+
+	tests := []struct {
+		name      string
+		body      interface{}
+		want      int
+		wantLevel jsonlog.Level
+	}{
+		{"debug", map[string]string{"level": "debug"}, http.StatusOK, jsonlog.LevelDebug},
+		{"upper case", map[string]string{"level": "WARN"}, http.StatusOK, jsonlog.LevelWarn},
+		{"off", map[string]string{"level": "off"}, http.StatusOK, jsonlog.LevelOff},
+		{"missing", map[string]string{}, http.StatusUnprocessableEntity, jsonlog.LevelOff},
+		{"unknown", map[string]string{"level": "verbose"}, http.StatusUnprocessableEntity, jsonlog.LevelOff},
+		{"wrong type", map[string]int{"level": 1}, http.StatusBadRequest, jsonlog.LevelOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPut, "/v1/admin/log-level", token, tt.body)
+			assertStatus(t, res, tt.want)
+
+			if got := app.logger.Level(); got != tt.wantLevel {
+				t.Errorf("got level %v, want %v", got, tt.wantLevel)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"goproject/pkg/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "alice@example.com", "characters:read", "players:read")
+
+	tests := []struct {
+		name      string
+		body      interface{}
+		want      int
+		wantField string
+		wantError string
+	}{
+		{"valid", map[string]interface{}{"name": "reports", "permissions": []string{"characters:read"}}, http.StatusCreated, "", ""},
+		{"with expiry", map[string]interface{}{"name": "temporary", "permissions": []string{"players:read"}, "expiry": time.Now().Add(time.Hour)}, http.StatusCreated, "", ""},
+		{"duplicate name", map[string]interface{}{"name": "reports", "permissions": []string{"characters:read"}}, http.StatusUnprocessableEntity, "name", "an api key with this name already exists"},
+		{"missing name", map[string]interface{}{"permissions": []string{"characters:read"}}, http.StatusUnprocessableEntity, "name", "must be provided"},
+		{"permission not held", map[string]interface{}{"name": "writer", "permissions": []string{"characters:write"}}, http.StatusUnprocessableEntity, "permissions", `you don't have the "characters:write" permission`},
+		{"past expiry", map[string]interface{}{"name": "expired", "permissions": []string{"characters:read"}, "expiry": time.Now().Add(-time.Hour)}, http.StatusUnprocessableEntity, "expiry", "must be in the future"},
+		{"bad expiry", map[string]interface{}{"name": "writer", "permissions": []string{"characters:read"}, "expiry": "tomorrow"}, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/me/api-keys", token, tt.body)
+			assertStatus(t, res, tt.want)
+
+			if tt.wantField != "" {
+				if got := res.errorField(t, tt.wantField); got != tt.wantError {
+					t.Errorf("got %s error %q, want %q", tt.wantField, got, tt.wantError)
+				}
+			}
+
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			var body struct {
+				APIKey data.APIKey `json:"api_key"`
+			}
+			res.decode(t, &body)
+
+			if got, want := res.header.Get("Location"), fmt.Sprintf("/v1/me/api-keys/%d", body.APIKey.ID); got != want {
+				t.Errorf("got Location %q, want %q", got, want)
+			}
+
+			res = ts.requestWithHeader(t, http.MethodGet, "/v1/healthcheck", http.Header{"X-Api-Key": {body.APIKey.Plaintext}}, nil)
+			assertStatus(t, res, http.StatusOK)
+		})
+	}
+}
+
+func TestListAndDeleteAPIKeys(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	alice, aliceToken := newAuthenticatedUser(t, app, "alice@example.com", "characters:read")
+	_, bobToken := newAuthenticatedUser(t, app, "bob@example.com", "characters:read")
+
+	key, err := app.models.APIKeys.New(context.Background(), alice.ID, "reports", data.Permissions{"characters:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := ts.request(t, http.MethodGet, "/v1/me/api-keys", aliceToken, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	var body struct {
+		APIKeys []data.APIKey `json:"api_keys"`
+	}
+	res.decode(t, &body)
+
+	if len(body.APIKeys) != 1 || body.APIKeys[0].Name != "reports" || body.APIKeys[0].Plaintext != "" {
+		t.Fatalf("got keys %+v, want reports without its plaintext", body.APIKeys)
+	}
+
+	res = ts.request(t, http.MethodGet, "/v1/me/api-keys", bobToken, nil)
+	res.decode(t, &body)
+
+	if len(body.APIKeys) != 0 {
+		t.Fatalf("bob can see alice's keys: %+v", body.APIKeys)
+	}
+
+	path := fmt.Sprintf("/v1/me/api-keys/%d", key.ID)
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"other user's key", path, bobToken, http.StatusNotFound},
+		{"bad id", "/v1/me/api-keys/abc", aliceToken, http.StatusNotFound},
+		{"own key", path, aliceToken, http.StatusOK},
+		{"already revoked", path, aliceToken, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodDelete, tt.path, tt.token, nil)
+			assertStatus(t, res, tt.want)
+		})
+	}
+
+	res = ts.requestWithHeader(t, http.MethodGet, "/v1/characters", http.Header{"X-Api-Key": {key.Plaintext}}, nil)
+	assertStatus(t, res, http.StatusUnauthorized)
+}
@@ -6,12 +6,14 @@ import (
 	"goproject/pkg/data"
 	"goproject/pkg/validator"
 	"net/http"
+	"github.com/julienschmidt/httprouter"
 )
 
 
 func (app *application) createCharacterHandler(w http.ResponseWriter, r *http.Request) {
 	
 	var input struct {
+		Slug      string   `json:"slug"`
 		Name      string   `json:"names"`
 		Health    int32    `json:"health"`
 		MoveSpeed int32    `json:"movespeed"`
@@ -25,7 +27,12 @@ func (app *application) createCharacterHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if input.Slug == "" {
+		input.Slug = data.Slugify(input.Name)
+	}
+
 	character := &data.Character{
+		Slug:      input.Slug,
 		Name:      input.Name,
 		Health:    input.Health,
 		MoveSpeed: input.MoveSpeed,
@@ -40,9 +47,15 @@ func (app *application) createCharacterHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = app.models.Characters.Insert(character)
+	err = app.models.Characters.Insert(r.Context(), character)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a character with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.databaseErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -65,7 +78,7 @@ func (app *application) showCharacterHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	character, err := app.models.Characters.Get(id)
+	character, err := app.models.Characters.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -89,7 +102,7 @@ func (app *application) updateCharacterHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	character, err := app.models.Characters.Get(id)
+	character, err := app.models.Characters.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -101,6 +114,7 @@ func (app *application) updateCharacterHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	var input struct {
+		Slug      *string   `json:"slug"`
 		Name      *string   `json:"names"`
 		Health    *int32    `json:"health"`
 		MoveSpeed *int32    `json:"movespeed"`
@@ -114,6 +128,10 @@ func (app *application) updateCharacterHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if input.Slug != nil {
+		character.Slug = *input.Slug
+	}
+
 	if input.Name != nil {
 		character.Name = *input.Name
 	}
@@ -141,12 +159,53 @@ func (app *application) updateCharacterHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = app.models.Characters.Update(character)
+	err = app.models.Characters.Update(r.Context(), character)
 	if err != nil {
 		switch {
+			case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a character with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 			case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 			default:
+			app.databaseErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"character": character}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bySlug serves routes such as /v1/characters/by-slug/:slug. httprouter
+// can't have a static segment beside the :id wildcard, so they are registered
+// as /v1/characters/:id/:slug and anything other than "by-slug" in the id
+// position is not found. pattern is recorded as the route instead.
+func (app *application) bySlug(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName("id") != "by-slug" {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		if info := app.contextGetRequestInfo(r); info != nil {
+			info.route = pattern
+		}
+		next(w, r)
+	}
+}
+
+func (app *application) showCharacterBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	slug := app.readSlugParam(r)
+
+	character, err := app.models.Characters.GetBySlug(r.Context(), slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
@@ -158,13 +217,65 @@ func (app *application) updateCharacterHandler(w http.ResponseWriter, r *http.Re
 	}
 }
 
+// replaceCharacterBySlugHandler creates the character at the slug, or
+// replaces every field of the existing one.
+func (app *application) replaceCharacterBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string   `json:"names"`
+		Health    int32    `json:"health"`
+		MoveSpeed int32    `json:"movespeed"`
+		Mana      int32    `json:"mana"`
+		Roles     []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	character := &data.Character{
+		Slug:      app.readSlugParam(r),
+		Name:      input.Name,
+		Health:    input.Health,
+		MoveSpeed: input.MoveSpeed,
+		Mana:      input.Mana,
+		Roles:     input.Roles,
+	}
+
+	v := validator.New()
+
+	if data.ValidateCharacter(v, character); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	created, err := app.models.Characters.Upsert(r.Context(), character)
+	if err != nil {
+		app.databaseErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	headers := make(http.Header)
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/characters/%d", character.ID))
+	}
+
+	err = app.writeJSON(w, status, envelope{"character": character}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteCharacterHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Characters.Delete(id)
+	err = app.models.Characters.Delete(r.Context(), id)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -207,7 +318,7 @@ func (app *application) listCharactersHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	characters,metadata, err := app.models.Characters.GetAll(input.Name, input.Roles, input.Filters)
+	characters,metadata, err := app.models.Characters.GetAll(r.Context(), input.Name, input.Roles, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
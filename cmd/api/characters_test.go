@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"goproject/pkg/data"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCreateCharacter(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "writer@example.com", "characters:read", "characters:write")
+	createTestCharacter(t, app, "Axe", "Initiator")
+
+	valid := map[string]interface{}{"names": "Nature's Prophet", "health": 560, "movespeed": 290, "mana": 300, "roles": []string{"Carry", "Pusher"}}
+
+	tests := []struct {
+		name      string
+		body      interface{}
+		want      int
+		wantField string
+		wantError string
+	}{
+		{"valid", valid, http.StatusCreated, "", ""},
+		{"missing name", map[string]interface{}{"health": 560, "movespeed": 290, "roles": []string{"Carry"}}, http.StatusUnprocessableEntity, "Name", "must be provided"},
+		{"negative health", map[string]interface{}{"names": "Lion", "health": -1, "movespeed": 290, "roles": []string{"Support"}}, http.StatusUnprocessableEntity, "Health", "must be greater than 0"},
+		{"missing roles", map[string]interface{}{"names": "Lion", "health": 500, "movespeed": 290}, http.StatusUnprocessableEntity, "Roles", "must be provided"},
+		{"duplicate roles", map[string]interface{}{"names": "Lion", "health": 500, "movespeed": 290, "roles": []string{"Support", "Support"}}, http.StatusUnprocessableEntity, "Roles", "must not contain duplicate values"},
+		{"invalid slug", map[string]interface{}{"slug": "Not A Slug", "names": "Lion", "health": 500, "movespeed": 290, "roles": []string{"Support"}}, http.StatusUnprocessableEntity, "slug", "must contain only lowercase letters, digits and single dashes"},
+		{"duplicate slug", map[string]interface{}{"names": "Axe", "health": 700, "movespeed": 310, "roles": []string{"Initiator"}}, http.StatusUnprocessableEntity, "slug", "a character with this slug already exists"},
+		{"wrong type", `{"names": "Lion", "health": "lots"}`, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/characters", token, tt.body)
+			assertStatus(t, res, tt.want)
+
+			if tt.wantField != "" {
+				if got := res.errorField(t, tt.wantField); got != tt.wantError {
+					t.Errorf("got %s error %q, want %q", tt.wantField, got, tt.wantError)
+				}
+			}
+		})
+	}
+
+	res := ts.request(t, http.MethodPost, "/v1/characters", token, map[string]interface{}{"names": "Sven", "health": 640, "movespeed": 290, "roles": []string{"Carry"}})
+	assertStatus(t, res, http.StatusCreated)
+
+	var body struct {
+		Character data.Character `json:"character"`
+	}
+	res.decode(t, &body)
+
+	if body.Character.Slug != "sven" {
+		t.Errorf("got slug %q, want it derived from the name", body.Character.Slug)
+	}
+	if got, want := res.header.Get("Location"), fmt.Sprintf("/v1/characters/%d", body.Character.ID); got != want {
+		t.Errorf("got Location %q, want %q", got, want)
+	}
+
+	res = ts.request(t, http.MethodGet, res.header.Get("Location"), token, nil)
+	assertStatus(t, res, http.StatusOK)
+}
+
+func TestShowCharacter(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "reader@example.com", "characters:read")
+	axe := createTestCharacter(t, app, "Axe", "Initiator")
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{fmt.Sprintf("/v1/characters/%d", axe.ID), http.StatusOK},
+		{"/v1/characters/999", http.StatusNotFound},
+		{"/v1/characters/0", http.StatusNotFound},
+		{"/v1/characters/-1", http.StatusNotFound},
+		{"/v1/characters/axe", http.StatusNotFound},
+		{"/v1/characters/by-slug/axe", http.StatusOK},
+		{"/v1/characters/by-slug/AXE", http.StatusOK},
+		{"/v1/characters/by-slug/lion", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res := ts.request(t, http.MethodGet, tt.path, token, nil)
+			assertStatus(t, res, tt.want)
+
+			if tt.want == http.StatusOK {
+				var body struct {
+					Character data.Character `json:"character"`
+				}
+				res.decode(t, &body)
+
+				if body.Character.ID != axe.ID || body.Character.Name != "Axe" {
+					t.Errorf("got character %+v", body.Character)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateCharacter(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "writer@example.com", "characters:read", "characters:write")
+	axe := createTestCharacter(t, app, "Axe", "Initiator")
+	createTestCharacter(t, app, "Lion", "Support")
+
+	path := fmt.Sprintf("/v1/characters/%d", axe.ID)
+
+	tests := []struct {
+		name string
+		path string
+		body interface{}
+		want int
+	}{
+		{"partial update", path, map[string]interface{}{"health": 720}, http.StatusOK},
+		{"invalid value", path, map[string]interface{}{"movespeed": 0}, http.StatusUnprocessableEntity},
+		{"taken slug", path, map[string]interface{}{"slug": "lion"}, http.StatusUnprocessableEntity},
+		{"unknown field", path, map[string]interface{}{"level": 25}, http.StatusBadRequest},
+		{"missing", "/v1/characters/999", map[string]interface{}{"health": 720}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPatch, tt.path, token, tt.body)
+			assertStatus(t, res, tt.want)
+		})
+	}
+
+	res := ts.request(t, http.MethodGet, path, token, nil)
+
+	var body struct {
+		Character data.Character `json:"character"`
+	}
+	res.decode(t, &body)
+
+	if body.Character.Health != 720 || body.Character.MoveSpeed != axe.MoveSpeed || body.Character.Slug != "axe" {
+		t.Errorf("got character %+v after updates", body.Character)
+	}
+}
+
+func TestReplaceCharacterBySlug(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "writer@example.com", "characters:read", "characters:write")
+
+	body := map[string]interface{}{"names": "Axe", "health": 700, "movespeed": 310, "mana": 290, "roles": []string{"Initiator"}}
+
+	res := ts.request(t, http.MethodPut, "/v1/characters/by-slug/axe", token, body)
+	assertStatus(t, res, http.StatusCreated)
+
+	if res.header.Get("Location") == "" {
+		t.Error("missing Location header on create")
+	}
+
+	body["health"] = 750
+	res = ts.request(t, http.MethodPut, "/v1/characters/by-slug/axe", token, body)
+	assertStatus(t, res, http.StatusOK)
+
+	var got struct {
+		Character data.Character `json:"character"`
+	}
+	res.decode(t, &got)
+
+	if got.Character.Health != 750 {
+		t.Errorf("got health %d, want 750", got.Character.Health)
+	}
+
+	res = ts.request(t, http.MethodPut, "/v1/characters/by-slug/not_a_slug", token, body)
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPut, "/v1/characters/by-slug/lion", token, map[string]interface{}{"names": "Lion"})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+}
+
+func TestDeleteCharacter(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "writer@example.com", "characters:read", "characters:write")
+	axe := createTestCharacter(t, app, "Axe", "Initiator")
+
+	path := fmt.Sprintf("/v1/characters/%d", axe.ID)
+
+	res := ts.request(t, http.MethodDelete, path, token, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	res = ts.request(t, http.MethodDelete, path, token, nil)
+	assertStatus(t, res, http.StatusNotFound)
+
+	res = ts.request(t, http.MethodGet, path, token, nil)
+	assertStatus(t, res, http.StatusNotFound)
+}
+
+func TestListCharacters(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "reader@example.com", "characters:read")
+
+	createTestCharacter(t, app, "Axe", "Initiator", "Durable")
+	createTestCharacter(t, app, "Lion", "Support", "Nuker")
+	createTestCharacter(t, app, "Lina", "Support", "Nuker", "Carry")
+	createTestCharacter(t, app, "Sven", "Carry", "Durable")
+
+	tests := []struct {
+		query        string
+		want         int
+		wantNames    []string
+		wantMetadata data.Metadata
+	}{
+		{"", http.StatusOK, []string{"Axe", "Lion", "Lina", "Sven"}, data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 4}},
+		{"?sort=-names", http.StatusOK, []string{"Sven", "Lion", "Lina", "Axe"}, data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 4}},
+		{"?roles=Support,Nuker", http.StatusOK, []string{"Lion", "Lina"}, data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2}},
+		{"?name=lina", http.StatusOK, []string{"Lina"}, data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1}},
+		{"?page=2&page_size=3", http.StatusOK, []string{"Sven"}, data.Metadata{CurrentPage: 2, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 4}},
+		{"?page=3&page_size=3", http.StatusOK, []string{}, data.Metadata{}},
+		{"?sort=level", http.StatusUnprocessableEntity, nil, data.Metadata{}},
+		{"?page=0", http.StatusUnprocessableEntity, nil, data.Metadata{}},
+		{"?page_size=101", http.StatusUnprocessableEntity, nil, data.Metadata{}},
+		{"?page=two", http.StatusUnprocessableEntity, nil, data.Metadata{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res := ts.request(t, http.MethodGet, "/v1/characters"+tt.query, token, nil)
+			assertStatus(t, res, tt.want)
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Characters []data.Character `json:"characters"`
+				Metadata   data.Metadata    `json:"metadata"`
+			}
+			res.decode(t, &body)
+
+			names := []string{}
+			for _, character := range body.Characters {
+				names = append(names, character.Name)
+			}
+
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("got %v, want %v", names, tt.wantNames)
+			}
+			if body.Metadata != tt.wantMetadata {
+				t.Errorf("got metadata %+v, want %+v", body.Metadata, tt.wantMetadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"goproject/pkg/jsonlog"
+	"goproject/pkg/validator"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// secret is a flag value which is never shown in full, so it can't leak
+// through -print-config, -help or a logged config.
+type secret string
+
+func (s *secret) Set(value string) error {
+	*s = secret(value)
+	return nil
+}
+
+func (s *secret) String() string {
+	if s == nil || *s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+func (s *secret) Get() interface{} {
+	return s.String()
+}
+
+// metaFlags control how the configuration is loaded, and so can't be set by
+// the configuration itself.
+var metaFlags = map[string]bool{
+	"config":       true,
+	"env-file":     true,
+	"print-config": true,
+}
+
+// envName is the environment variable which can set a flag, e.g. DB_DSN for
+// -db-dsn.
+func envName(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// configure sets every flag which wasn't given on the command line from its
+// environment variable or, failing that, from the config file. Variables in
+// envFile are added to the environment first, without overriding ones which
+// are already set. The config file can also be named by $CONFIG.
+func configure(flags *flag.FlagSet, envFile, configFile string) error {
+	err := godotenv.Load(envFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("loading %s: %w", envFile, err)
+	}
+
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit["config"] {
+		if value, ok := os.LookupEnv("CONFIG"); ok {
+			configFile = value
+		}
+	}
+
+	var file map[string]string
+	if configFile != "" {
+		file, err = readConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+
+		for name := range file {
+			if flags.Lookup(name) == nil || metaFlags[name] {
+				return fmt.Errorf("%s: unknown setting %q", configFile, name)
+			}
+		}
+	}
+
+	var setErr error
+	flags.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || metaFlags[f.Name] || setErr != nil {
+			return
+		}
+
+		source := envName(f.Name)
+		value, ok := os.LookupEnv(source)
+		if !ok {
+			source = configFile
+			value, ok = file[f.Name]
+		}
+		if !ok {
+			return
+		}
+
+		err := flags.Set(f.Name, value)
+		if err != nil {
+			setErr = fmt.Errorf("%s: invalid value %q for %s: %w", source, value, f.Name, err)
+		}
+	})
+
+	return setErr
+}
+
+// readConfigFile reads a YAML file of settings named after the flags. Nested
+// keys are joined with dashes, so these are equivalent:
+//
+//	db-max-open-conns: 50
+//
+//	db:
+//	  max-open-conns: 50
+//
+// Lists are joined with commas, for settings such as trusted-proxies.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]interface{}
+	err = yaml.Unmarshal(b, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	flat := make(map[string]string)
+	err = flatten(flat, "", settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return flat, nil
+}
+
+func flatten(flat map[string]string, prefix string, settings map[string]interface{}) error {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			err := flatten(flat, key, value)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			flat[key] = strings.Join(items, ",")
+		case nil:
+			flat[key] = ""
+		default:
+			flat[key] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+// printConfig writes the effective settings as YAML which can be used as a
+// config file. Secrets are redacted.
+func printConfig(w io.Writer, flags *flag.FlagSet) error {
+	settings := make(map[string]interface{})
+	flags.VisitAll(func(f *flag.Flag) {
+		if metaFlags[f.Name] {
+			return
+		}
+
+		switch value := f.Value.(flag.Getter).Get().(type) {
+		case time.Duration:
+			settings[f.Name] = value.String()
+		default:
+			settings[f.Name] = value
+		}
+	})
+
+	return yaml.NewEncoder(w).Encode(settings)
+}
+
+// validate checks the settings together, reporting errors by flag name.
+func (cfg config) validate(v *validator.Validator) {
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+
+	v.Check(validator.In(cfg.storage, "postgres", "memory"), "storage", "must be postgres or memory")
+
+	v.Check(cfg.storage != "postgres" || cfg.db.dsn != "", "db-dsn", "must be provided, e.g. with DB_DSN")
+	v.Check(cfg.db.queryTimeout > 0, "db-query-timeout", "must be greater than zero")
+	v.Check(cfg.db.maxOpenConns >= 0, "db-max-open-conns", "must not be negative")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	v.Check(cfg.db.maxOpenConns == 0 || cfg.db.maxIdleConns <= cfg.db.maxOpenConns, "db-max-idle-conns", "must not be more than db-max-open-conns")
+	v.Check(cfg.db.maxIdleTime >= 0, "db-max-idle-time", "must not be negative")
+	v.Check(cfg.db.maxLifetime >= 0, "db-max-lifetime", "must not be negative")
+	v.Check(cfg.db.connectTimeout >= 0, "db-connect-timeout", "must not be negative")
+	v.Check(!cfg.db.autoMigrate || cfg.storage == "postgres", "auto-migrate", "must not be set when storage is memory")
+
+	_, err := jsonlog.ParseLevel(cfg.log.level)
+	v.Check(err == nil, "log-level", "must be debug, info, warn, error, fatal or off")
+
+	v.Check(validator.In(cfg.otel.exporter, "none", "stdout", "otlp"), "otel-exporter", "must be none, stdout or otlp")
+	v.Check(cfg.otel.exporter != "otlp" || cfg.otel.endpoint != "", "otel-endpoint", "must be provided for the otlp exporter")
+	v.Check(cfg.otel.sampleRatio >= 0 && cfg.otel.sampleRatio <= 1, "otel-sample-ratio", "must be between 0 and 1")
+
+	if cfg.metrics.addr != "" {
+		_, _, err = net.SplitHostPort(cfg.metrics.addr)
+		v.Check(err == nil, "metrics-addr", "must be a host:port address")
+	}
+
+	v.Check(cfg.health.timeout > 0, "health-timeout", "must be greater than zero")
+	v.Check(cfg.health.shutdownDelay >= 0, "shutdown-delay", "must not be negative")
+
+	v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+	v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+	v.Check(cfg.limiter.ipRPS > 0, "limiter-ip-rps", "must be greater than zero")
+	v.Check(cfg.limiter.ipBurst > 0, "limiter-ip-burst", "must be greater than zero")
+	v.Check(validator.In(cfg.limiter.store, "memory", "postgres"), "limiter-store", "must be memory or postgres")
+	v.Check(cfg.limiter.store != "postgres" || cfg.storage == "postgres", "limiter-store", "must be memory when storage is memory")
+
+	v.Check(validator.In(cfg.auth.mode, authModeOpaque, authModeJWT), "auth-mode", "must be opaque or jwt")
+	v.Check(cfg.auth.accessTokenTTL > 0, "auth-access-ttl", "must be greater than zero")
+	v.Check(cfg.auth.refreshTokenTTL > 0, "auth-refresh-ttl", "must be greater than zero")
+	v.Check(cfg.auth.mode != authModeJWT || cfg.jwt.keys != "", "jwt-keys", "must be provided when auth-mode is jwt")
+
+	v.Check(cfg.login.maxFailures > 0, "login-max-failures", "must be greater than zero")
+	v.Check(cfg.login.ipMaxFailures > 0, "login-ip-max-failures", "must be greater than zero")
+	v.Check(cfg.login.lockout > 0, "login-lockout", "must be greater than zero")
+	v.Check(cfg.login.backoffBase > 0, "login-backoff-base", "must be greater than zero")
+	v.Check(cfg.login.backoffMax >= cfg.login.backoffBase, "login-backoff-max", "must not be less than login-backoff-base")
+
+	v.Check(cfg.totp.issuer != "", "totp-issuer", "must be provided")
+	v.Check(cfg.totp.challengeTTL > 0, "totp-challenge-ttl", "must be greater than zero")
+
+	if cfg.oidc.issuer != "" {
+		v.Check(cfg.oidc.clientID != "", "oidc-client-id", "must be provided when oidc-issuer is set")
+		v.Check(cfg.oidc.redirectURL != "", "oidc-redirect-url", "must be provided when oidc-issuer is set")
+		v.Check(cfg.env != "production" || cfg.oidc.stateSecret != "", "oidc-state-secret", "must be provided in production")
+	}
+
+	v.Check(cfg.smtp.host != "", "smtp-host", "must be provided")
+	v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+}
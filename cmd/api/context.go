@@ -6,9 +6,26 @@ import (
 )
 
 type contextKey string
-const userContextKey = contextKey("user")
+const (
+	userContextKey = contextKey("user")
+	permissionsContextKey = contextKey("permissions")
+	apiKeyContextKey = contextKey("api_key")
+	requestInfoContextKey = contextKey("request_info")
+)
+
+// requestInfo is created once per request by the requestID middleware and
+// filled in as the request is handled, so middleware wrapping the router can
+// see what was learned further in, such as the matched route and the user.
+type requestInfo struct {
+	id    string
+	route string
+	user  *data.User
+}
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if info := app.contextGetRequestInfo(r); info != nil {
+		info.user = user
+	}
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -19,4 +36,45 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 		panic("missing user value in request context")
 	}
 	return user
-}
\ No newline at end of file
+}
+
+// contextSetPermissions records permissions which were established while
+// authenticating, so requirePermission doesn't need to query the database.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was authenticated with, or
+// nil when it wasn't authenticated with one.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+func (app *application) contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
+
+func (app *application) contextGetRequestID(r *http.Request) string {
+	if info := app.contextGetRequestInfo(r); info != nil {
+		return info.id
+	}
+	return ""
+}
@@ -1,18 +1,27 @@
 package main
 import (
+	"errors"
 	"fmt"
+	"goproject/pkg/data"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
+	app.requestLogger(r).PrintError(err, map[string]interface{}{
 		"request_method": r.Method,
 		"request_url": r.URL.String(),
+		"client_ip": app.clientIP(r),
 	})
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
 	env := envelope{"error": message}
+	if id := app.contextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
 	err := app.writeJSON(w, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
@@ -49,11 +58,52 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
-func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+// databaseErrorResponse reports a write the database refused: 409 for
+// duplicates and for transactions which clashed with another, and 422 for
+// other constraint violations. Anything else is a server error.
+func (app *application) databaseErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var constraintErr *data.ConstraintError
+
+	switch {
+	case errors.Is(err, data.ErrSerializationFailure):
+		message := "unable to complete the request due to a concurrent update, please try again"
+		app.errorResponse(w, r, http.StatusConflict, message)
+	case errors.As(err, &constraintErr):
+		field := constraintErr.Column
+		if field == "" {
+			field = constraintErr.Constraint
+		}
+
+		switch constraintErr.Kind {
+		case data.ConstraintUnique:
+			app.errorResponse(w, r, http.StatusConflict, map[string]string{field: "a record with this value already exists"})
+		case data.ConstraintForeignKey:
+			app.failedValidationResponse(w, r, map[string]string{field: "refers to a record which does not exist"})
+		case data.ConstraintNotNull:
+			app.failedValidationResponse(w, r, map[string]string{field: "must be provided"})
+		default:
+			app.failedValidationResponse(w, r, map[string]string{field: "is not valid"})
+		}
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, locked bool) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please try again later"
+	if locked {
+		message = "this account is temporarily locked due to too many failed login attempts"
+	}
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -65,6 +115,30 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired api key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidMFAChallengeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired mfa token, please log in again"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidOIDCStateResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired login state, please start the login again"
+	app.errorResponse(w, r, http.StatusBadRequest, message)
+}
+
+func (app *application) oidcLoginFailedResponse(w http.ResponseWriter, r *http.Request, message string) {
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
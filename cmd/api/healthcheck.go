@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"goproject/pkg/migrations"
+	"net"
 	"net/http"
+	"time"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,3 +23,106 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 	}
 		
 }
+
+// liveHandler reports that the process is up and serving requests. It
+// deliberately checks nothing else, so a database outage doesn't get every
+// replica restarted.
+func (app *application) liveHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readyHandler reports whether this instance should be sent traffic: the
+// database is reachable and migrated to the version this build expects, SMTP
+// is reachable if configured to check it, and the server isn't shutting down.
+func (app *application) readyHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+
+	report := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	if app.shuttingDown.Load() {
+		report("server", fmt.Errorf("shutting down"))
+	} else {
+		report("server", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.config.health.timeout)
+	defer cancel()
+
+	// With -storage=memory there is no database to check.
+	if app.db != nil {
+		err := app.db.PingContext(ctx)
+		report("database", err)
+
+		if err == nil {
+			report("migrations", app.checkSchemaVersion(ctx))
+		}
+	}
+
+	if app.config.health.smtp {
+		report("smtp", app.checkSMTP(ctx))
+	}
+
+	status := http.StatusOK
+	env := envelope{"status": "ready", "checks": checks}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		env["status"] = "not ready"
+	}
+
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) checkSchemaVersion(ctx context.Context) error {
+	want, err := migrations.Latest()
+	if err != nil {
+		return err
+	}
+
+	got, dirty, err := migrations.Version(ctx, app.db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case dirty:
+		return fmt.Errorf("migration %d failed and needs fixing", got)
+	case got != want:
+		return fmt.Errorf("schema is at version %d, expected %d", got, want)
+	}
+
+	return nil
+}
+
+func (app *application) checkSMTP(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(app.config.smtp.host, fmt.Sprint(app.config.smtp.port)))
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
+	return nil
+}
+
+// drainDelay keeps serving, while reporting not ready, for long enough that
+// load balancers stop routing new requests to this instance.
+func (app *application) drainDelay() {
+	if app.config.health.shutdownDelay > 0 {
+		time.Sleep(app.config.health.shutdownDelay)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHealthcheck(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.request(t, http.MethodGet, "/v1/healthcheck", "", nil)
+	assertStatus(t, res, http.StatusOK)
+
+	var body struct {
+		Status     string            `json:"status"`
+		SystemInfo map[string]string `json:"system_info"`
+	}
+	res.decode(t, &body)
+
+	if body.Status != "available" || body.SystemInfo["environment"] != "development" || body.SystemInfo["version"] != version {
+		t.Errorf("got %+v", body)
+	}
+
+	res = ts.request(t, http.MethodGet, "/v1/healthcheck/live", "", nil)
+	assertStatus(t, res, http.StatusOK)
+}
+
+func TestReady(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+
+	// With in-memory models there is no database to check.
+	res := ts.request(t, http.MethodGet, "/v1/healthcheck/ready", "", nil)
+	assertStatus(t, res, http.StatusOK)
+	res.decode(t, &body)
+
+	if body.Status != "ready" || len(body.Checks) != 1 || body.Checks["server"] != "ok" {
+		t.Errorf("got %+v", body)
+	}
+
+	app.shuttingDown.Store(true)
+
+	res = ts.request(t, http.MethodGet, "/v1/healthcheck/ready", "", nil)
+	assertStatus(t, res, http.StatusServiceUnavailable)
+	res.decode(t, &body)
+
+	if body.Status != "not ready" || body.Checks["server"] != "shutting down" {
+		t.Errorf("got %+v", body)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	ts.request(t, http.MethodGet, "/v1/characters/42", "", nil)
+
+	// Metrics are only served on their own listener.
+	res := ts.request(t, http.MethodGet, "/metrics", "", nil)
+	assertStatus(t, res, http.StatusNotFound)
+
+	metrics := &testServer{app: app, handler: app.metricsRoutes()}
+
+	res = metrics.request(t, http.MethodGet, "/metrics", "", nil)
+	assertStatus(t, res, http.StatusOK)
+
+	// Requests are labelled by route pattern, not by path.
+	want := `http_requests_total{method="GET",route="/v1/characters/:id",status="401"} 1`
+	if !strings.Contains(string(res.body), want) {
+		t.Errorf("metrics don't contain %s", want)
+	}
+}
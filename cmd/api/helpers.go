@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt" 
 	"net/url"
+	"goproject/pkg/jsonlog"
 	"goproject/pkg/validator"
 	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"io" 
 	"net/http"
 	"strconv"
@@ -22,6 +29,13 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readSlugParam returns the slug parameter lowercased, since slugs are
+// matched without regard to case.
+func (app *application) readSlugParam(r *http.Request) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	return strings.ToLower(params.ByName("slug"))
+}
+
 type envelope map[string]interface{}
 
 
@@ -54,7 +68,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	dec.DisallowUnknownFields()
 
 
-	err := json.NewDecoder(r.Body).Decode(dst)
+	err := dec.Decode(dst)
 	if err != nil {
 
 		var syntaxError *json.SyntaxError
@@ -123,8 +137,10 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
+	app.metrics.background.Inc()
 	go func() {
 	defer app.wg.Done()
+	defer app.metrics.background.Dec()
 	defer func() {
 		if err := recover(); err != nil {
 		app.logger.PrintError(fmt.Errorf("%s", err), nil)
@@ -132,4 +148,64 @@ func (app *application) background(fn func()) {
 	}()
 	fn()
 	}()
-}
\ No newline at end of file
+}
+
+// validRequestID reports whether a client supplied request ID is short and
+// free of characters which could be used to forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// requestLogger returns a logger which tags every line with the request ID.
+func (app *application) requestLogger(r *http.Request) *jsonlog.Logger {
+	return app.logger.With(map[string]interface{}{
+		"request_id": app.contextGetRequestID(r),
+	})
+}
+
+// sendMail sends an email from the template and counts the result. ctx is
+// only used to parent the span, so it may already be cancelled.
+func (app *application) sendMail(ctx context.Context, recipient, templateFile string, data interface{}) error {
+	_, span := tracer.Start(ctx, "mailer.Send", trace.WithAttributes(attribute.String("mail.template", templateFile)))
+	defer span.End()
+
+	err := app.mailer.Send(recipient, templateFile, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "send failed")
+		app.metrics.mail.WithLabelValues(templateFile, "failure").Inc()
+		return err
+	}
+	app.metrics.mail.WithLabelValues(templateFile, "success").Inc()
+	return nil
+}
+
+// clientIP returns the IP address of the client which made the request,
+// looking through any trusted proxies.
+func (app *application) clientIP(r *http.Request) string {
+	return app.ipResolver.ClientIP(r)
+}
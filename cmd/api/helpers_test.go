@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadJSON(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", `{"name": "Axe", "health": 700}`, ""},
+		{"empty body", ``, "body must not be empty"},
+		{"badly-formed", `{"name": }`, "body contains badly-formed JSON (at character 10)"},
+		{"truncated", `{"name": "Axe"`, "body contains badly-formed JSON"},
+		{"wrong field type", `{"health": "lots"}`, `body contains incorrect JSON type for field "health"`},
+		{"wrong value type", `["Axe"]`, "body contains incorrect JSON type (at character 1)"},
+		{"unknown key", `{"name": "Axe", "level": 25}`, `body contains unknown key "level"`},
+		{"two values", `{"name": "Axe"}{"name": "Lion"}`, "body must only contain a single JSON value"},
+		{"too large", `{"name": "` + strings.Repeat("a", 1_048_576) + `"}`, "body must not be larger than 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				Name   string `json:"name"`
+				Health int32  `json:"health"`
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			err := app.readJSON(httptest.NewRecorder(), r, &input)
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("got no error, want %q", tt.wantErr)
+			case tt.wantErr != "" && err.Error() != tt.wantErr:
+				t.Fatalf("got error %q, want %q", err, tt.wantErr)
+			}
+
+			if tt.wantErr == "" && (input.Name != "Axe" || input.Health != 700) {
+				t.Errorf("decoded %+v", input)
+			}
+		})
+	}
+}
+
+func TestReadJSONErrorResponse(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", `{"email": "a@example.com", "password": "pa55word1234", "remember": true}`)
+	assertStatus(t, res, http.StatusBadRequest)
+
+	if got, want := res.errorMessage(t), `body contains unknown key "remember"`; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"", false},
+		{"abc-123_DEF.4:5", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"abc def", false},
+		{"abc\ninjected", false},
+		{"abc\"", false},
+	}
+
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.want {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
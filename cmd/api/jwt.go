@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"goproject/pkg/data"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+const (
+	authModeOpaque = "opaque"
+	authModeJWT    = "jwt"
+)
+
+var errInvalidJWT = errors.New("invalid JWT")
+
+// jwtKeys holds every key accepted for verification, indexed by kid, and the
+// kid of the key used to sign new tokens. Keeping retired keys in the list
+// lets tokens signed before a rotation stay valid until they expire.
+type jwtKeys struct {
+	signingKID string
+	hmac       map[string][]byte
+	ed25519    map[string]ed25519.PrivateKey
+	register   jwt.KeyRegister
+}
+
+// parseJWTKeys reads a comma-separated list of kid:alg:base64-key entries,
+// where alg is either HS256 (a secret of at least 32 bytes) or EdDSA (a 32
+// byte Ed25519 seed).
+func parseJWTKeys(spec, signingKID string) (*jwtKeys, error) {
+	keys := &jwtKeys{
+		hmac:    make(map[string][]byte),
+		ed25519: make(map[string]ed25519.PrivateKey),
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("jwt key %q must have the form kid:alg:base64-key", entry)
+		}
+		kid, alg := parts[0], parts[1]
+
+		if _, exists := keys.hmac[kid]; exists {
+			return nil, fmt.Errorf("jwt key id %q is used more than once", kid)
+		}
+		if _, exists := keys.ed25519[kid]; exists {
+			return nil, fmt.Errorf("jwt key id %q is used more than once", kid)
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kid, err)
+		}
+
+		switch alg {
+		case jwt.HS256:
+			if len(raw) < 32 {
+				return nil, fmt.Errorf("jwt key %q: HS256 secret must be at least 32 bytes", kid)
+			}
+			keys.hmac[kid] = raw
+			keys.register.Secrets = append(keys.register.Secrets, raw)
+			keys.register.SecretIDs = append(keys.register.SecretIDs, kid)
+		case jwt.EdDSA:
+			if len(raw) != ed25519.SeedSize {
+				return nil, fmt.Errorf("jwt key %q: EdDSA seed must be %d bytes", kid, ed25519.SeedSize)
+			}
+			private := ed25519.NewKeyFromSeed(raw)
+			keys.ed25519[kid] = private
+			keys.register.EdDSAs = append(keys.register.EdDSAs, private.Public().(ed25519.PublicKey))
+			keys.register.EdDSAIDs = append(keys.register.EdDSAIDs, kid)
+		default:
+			return nil, fmt.Errorf("jwt key %q: unsupported algorithm %q", kid, alg)
+		}
+
+		if signingKID == "" {
+			signingKID = kid
+		}
+	}
+
+	if len(keys.hmac)+len(keys.ed25519) == 0 {
+		return nil, errors.New("no jwt keys configured")
+	}
+
+	_, isHMAC := keys.hmac[signingKID]
+	_, isEd25519 := keys.ed25519[signingKID]
+	if !isHMAC && !isEd25519 {
+		return nil, fmt.Errorf("jwt signing key %q is not configured", signingKID)
+	}
+	keys.signingKID = signingKID
+
+	return keys, nil
+}
+
+// newJWTAccessToken signs a stateless authentication token carrying the
+// user's id, activation status and permission codes.
+func (app *application) newJWTAccessToken(user *data.User, permissions data.Permissions) (*data.Token, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.auth.accessTokenTTL)
+
+	codes := make([]interface{}, len(permissions))
+	for i, code := range permissions {
+		codes[i] = code
+	}
+
+	var claims jwt.Claims
+	claims.Subject = strconv.FormatInt(user.ID, 10)
+	claims.Issuer = app.config.jwt.issuer
+	claims.Audiences = []string{app.config.jwt.issuer}
+	claims.Issued = jwt.NewNumericTime(now)
+	claims.NotBefore = jwt.NewNumericTime(now)
+	claims.Expires = jwt.NewNumericTime(expiry)
+	claims.KeyID = app.jwtKeys.signingKID
+	claims.Set = map[string]interface{}{
+		"activated":   user.Activated,
+		"permissions": codes,
+	}
+
+	var (
+		token []byte
+		err   error
+	)
+	if secret, ok := app.jwtKeys.hmac[claims.KeyID]; ok {
+		token, err = claims.HMACSign(jwt.HS256, secret)
+	} else {
+		token, err = claims.EdDSASign(app.jwtKeys.ed25519[claims.KeyID])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: string(token),
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     data.ScopeAuthentication,
+	}, nil
+}
+
+// parseJWTAccessToken verifies a token offline. The returned user only carries
+// the id and activation status; handlers needing more must load it.
+func (app *application) parseJWTAccessToken(token string) (*data.User, data.Permissions, error) {
+	claims, err := app.jwtKeys.register.Check([]byte(token))
+	if err != nil {
+		return nil, nil, errInvalidJWT
+	}
+
+	if !claims.Valid(time.Now()) {
+		return nil, nil, errInvalidJWT
+	}
+
+	if claims.Issuer != app.config.jwt.issuer || !claims.AcceptAudience(app.config.jwt.issuer) {
+		return nil, nil, errInvalidJWT
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || userID < 1 {
+		return nil, nil, errInvalidJWT
+	}
+
+	activated, _ := claims.Set["activated"].(bool)
+
+	codes, _ := claims.Set["permissions"].([]interface{})
+	permissions := make(data.Permissions, 0, len(codes))
+	for _, code := range codes {
+		if s, ok := code.(string); ok {
+			permissions = append(permissions, s)
+		}
+	}
+
+	user := &data.User{
+		ID:        userID,
+		Activated: activated,
+	}
+
+	return user, permissions, nil
+}
+
+// isJWT reports whether a bearer token looks like a compact JWS rather than
+// one of our 26 character opaque tokens.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"goproject/pkg/data"
+	"goproject/pkg/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func loginAccountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginBackoff is how long a client must wait after its nth consecutive
+// failure before trying again. It doubles with every failure.
+func (app *application) loginBackoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	delay := app.config.login.backoffBase
+	for i := 1; i < failures && delay < app.config.login.backoffMax; i++ {
+		delay *= 2
+	}
+
+	if delay > app.config.login.backoffMax {
+		delay = app.config.login.backoffMax
+	}
+	return delay
+}
+
+// checkLoginThrottle returns how long the client has to wait before another
+// login attempt for email is allowed, and whether that is due to a lockout
+// rather than ordinary backoff.
+func (app *application) checkLoginThrottle(r *http.Request, email string) (time.Duration, bool, error) {
+	now := time.Now()
+
+	var (
+		retryAfter time.Duration
+		locked     bool
+	)
+
+	for _, key := range []string{loginAccountKey(email), loginIPKey(app.clientIP(r))} {
+		failure, err := app.models.LoginFailures.Get(r.Context(), key)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue
+			}
+			return 0, false, err
+		}
+
+		if failure.Locked(now) {
+			locked = true
+			if wait := failure.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+			continue
+		}
+
+		if wait := failure.LastFailureAt.Add(app.loginBackoff(failure.Failures)).Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter, locked, nil
+}
+
+// recordLoginFailure counts a failed attempt against both the account and
+// the client IP, locking either out once it passes its threshold. user is nil
+// when the email didn't match an account; failures are still counted so the
+// response doesn't reveal which emails are registered.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) error {
+	now := time.Now()
+	ip := app.clientIP(r)
+
+	account, err := app.models.LoginFailures.Record(r.Context(), loginAccountKey(email), app.config.login.lockout)
+	if err != nil {
+		return err
+	}
+
+	if account.Failures >= app.config.login.maxFailures && !account.Locked(now) {
+		err = app.models.LoginFailures.Lock(r.Context(), account.Key, now.Add(app.config.login.lockout))
+		if err != nil {
+			return err
+		}
+
+		event := &data.AuditEvent{
+			Event:   data.AuditLoginLockout,
+			IP:      ip,
+			Details: map[string]string{"email": email},
+		}
+		if user != nil {
+			event.UserID = &user.ID
+		}
+		app.audit(r, event)
+
+		if user != nil {
+			err = app.sendUnlockEmail(r, user)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	client, err := app.models.LoginFailures.Record(r.Context(), loginIPKey(ip), app.config.login.lockout)
+	if err != nil {
+		return err
+	}
+
+	if client.Failures >= app.config.login.ipMaxFailures && !client.Locked(now) {
+		err = app.models.LoginFailures.Lock(r.Context(), client.Key, now.Add(app.config.login.lockout))
+		if err != nil {
+			return err
+		}
+
+		app.audit(r, &data.AuditEvent{
+			Event: data.AuditLoginIPLockout,
+			IP:    ip,
+		})
+	}
+
+	return nil
+}
+
+// clearLoginFailures resets the account's failure count after a successful
+// login. The IP count is left alone so an attacker can't reset it by logging
+// into an account of their own between guesses.
+func (app *application) clearLoginFailures(ctx context.Context, email string) error {
+	return app.models.LoginFailures.Reset(ctx, loginAccountKey(email))
+}
+
+func (app *application) sendUnlockEmail(r *http.Request, user *data.User) error {
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 24*time.Hour, data.ScopeUnlock)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"unlockToken": token.Plaintext,
+			"lockout":     app.config.login.lockout.String(),
+		}
+
+		err := app.sendMail(r.Context(), user.Email, "account_unlock.tmpl", data)
+		if err != nil {
+			app.requestLogger(r).PrintError(err, nil)
+		}
+	})
+
+	return nil
+}
+
+// audit records a security event. Failing to write it shouldn't fail the
+// request, so errors are only logged.
+func (app *application) audit(r *http.Request, event *data.AuditEvent) {
+	err := app.models.Audit.Insert(r.Context(), event)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.clearLoginFailures(r.Context(), user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeUnlock, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{
+		Event:  data.AuditAccountUnlock,
+		UserID: &user.ID,
+		IP:     app.clientIP(r),
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account has been unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
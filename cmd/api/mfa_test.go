@@ -0,0 +1,338 @@
+package main
+
+import (
+	"goproject/pkg/totp"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// totpCode returns the code for the current time step plus offset. Each use
+// of a code must be for a later step than the last, and within totpSkew.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// enableTOTP enrolls and confirms two-factor authentication for the token's
+// user, returning the secret and recovery codes. The step before the current
+// one is used to confirm.
+func enableTOTP(t *testing.T, ts *testServer, token string) (string, []string) {
+	t.Helper()
+
+	res := ts.request(t, http.MethodPost, "/v1/me/mfa/totp", token, nil)
+	assertStatus(t, res, http.StatusCreated)
+
+	var enrollment struct {
+		TOTP map[string]string `json:"totp"`
+	}
+	res.decode(t, &enrollment)
+	secret := enrollment.TOTP["secret"]
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/totp/confirm", token, map[string]string{"code": totpCode(t, secret, -1)})
+	assertStatus(t, res, http.StatusOK)
+
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	res.decode(t, &confirmed)
+
+	return secret, confirmed.RecoveryCodes
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "alice@example.com")
+
+	res := ts.request(t, http.MethodPost, "/v1/me/mfa/totp/confirm", token, map[string]string{"code": "123456"})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	if got, want := res.errorField(t, "totp"), "two-factor authentication enrollment has not been started"; got != want {
+		t.Errorf("got totp error %q, want %q", got, want)
+	}
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/totp", token, nil)
+	assertStatus(t, res, http.StatusCreated)
+
+	var enrollment struct {
+		TOTP map[string]string `json:"totp"`
+	}
+	res.decode(t, &enrollment)
+
+	if !strings.HasPrefix(enrollment.TOTP["provisioning_uri"], "otpauth://totp/Test:alice@example.com?") {
+		t.Errorf("got provisioning uri %q", enrollment.TOTP["provisioning_uri"])
+	}
+
+	tests := []struct {
+		name      string
+		code      string
+		wantField string
+		wantError string
+	}{
+		{"missing code", "", "code", "must be provided"},
+		{"short code", "123", "code", "must be 6 digits long"},
+		{"wrong code", wrongCode(totpCode(t, enrollment.TOTP["secret"], 0)), "code", "invalid authentication code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/me/mfa/totp/confirm", token, map[string]string{"code": tt.code})
+			assertStatus(t, res, http.StatusUnprocessableEntity)
+
+			if got := res.errorField(t, tt.wantField); got != tt.wantError {
+				t.Errorf("got %s error %q, want %q", tt.wantField, got, tt.wantError)
+			}
+		})
+	}
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/totp/confirm", token, map[string]string{"code": totpCode(t, enrollment.TOTP["secret"], 0)})
+	assertStatus(t, res, http.StatusOK)
+
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	res.decode(t, &confirmed)
+
+	if len(confirmed.RecoveryCodes) == 0 {
+		t.Error("no recovery codes returned")
+	}
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/totp", token, nil)
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/totp/confirm", token, map[string]string{"code": totpCode(t, enrollment.TOTP["secret"], 1)})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+}
+
+func TestMFALogin(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.login.maxFailures = 10
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "alice@example.com", "characters:read")
+	secret, recoveryCodes := enableTOTP(t, ts, token)
+
+	login := func(t *testing.T) string {
+		t.Helper()
+
+		res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+		assertStatus(t, res, http.StatusOK)
+
+		var body struct {
+			MFARequired bool `json:"mfa_required"`
+			MFAToken    struct {
+				Plaintext string `json:"token"`
+			} `json:"mfa_token"`
+		}
+		res.decode(t, &body)
+
+		if !body.MFARequired || body.MFAToken.Plaintext == "" {
+			t.Fatalf("got %s, want an mfa challenge", res.body)
+		}
+
+		return body.MFAToken.Plaintext
+	}
+
+	challenge := login(t)
+
+	tests := []struct {
+		name string
+		body map[string]string
+		want int
+	}{
+		{"no code", map[string]string{"mfa_token": challenge}, http.StatusUnprocessableEntity},
+		{"both codes", map[string]string{"mfa_token": challenge, "code": "123456", "recovery_code": recoveryCodes[0]}, http.StatusUnprocessableEntity},
+		{"unknown challenge", map[string]string{"mfa_token": strings.Repeat("A", 26), "code": "123456"}, http.StatusUnauthorized},
+		{"challenge used as bearer", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.body == nil {
+				res := ts.request(t, http.MethodGet, "/v1/characters", challenge, nil)
+				assertStatus(t, res, tt.want)
+				return
+			}
+
+			res := ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", tt.body)
+			assertStatus(t, res, tt.want)
+		})
+	}
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "code": wrongCode(totpCode(t, secret, 0))})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	// A wrong code uses up the challenge, even for a right code afterwards.
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "code": totpCode(t, secret, 0)})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	challenge = login(t)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "recovery_code": "aaaaa-bbbbb"})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	challenge = login(t)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "code": totpCode(t, secret, 0)})
+	assertStatus(t, res, http.StatusCreated)
+
+	var tokens tokenPair
+	res.decode(t, &tokens)
+
+	res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	// The challenge is single use.
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "code": totpCode(t, secret, 1)})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	challenge = login(t)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "recovery_code": recoveryCodes[0]})
+	assertStatus(t, res, http.StatusCreated)
+
+	// So is each recovery code.
+	challenge = login(t)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": challenge, "recovery_code": recoveryCodes[0]})
+	assertStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestMFALoginLockout(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "alice@example.com")
+	secret, _ := enableTOTP(t, ts, token)
+
+	credentials := map[string]string{"email": "alice@example.com", "password": testPassword}
+
+	// The right password doesn't reset the count while the second factor is
+	// still outstanding.
+	for i := 0; i < app.config.login.maxFailures; i++ {
+		res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", credentials)
+		assertStatus(t, res, http.StatusOK)
+
+		var body struct {
+			MFAToken struct {
+				Plaintext string `json:"token"`
+			} `json:"mfa_token"`
+		}
+		res.decode(t, &body)
+
+		res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": body.MFAToken.Plaintext, "code": wrongCode(totpCode(t, secret, 0))})
+		assertStatus(t, res, http.StatusUnauthorized)
+	}
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", credentials)
+	assertStatus(t, res, http.StatusTooManyRequests)
+}
+
+func TestManageTOTP(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.login.maxFailures = 10
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "alice@example.com")
+
+	res := ts.request(t, http.MethodPost, "/v1/me/mfa/recovery-codes", token, map[string]string{"code": "123456"})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	secret, oldCodes := enableTOTP(t, ts, token)
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/recovery-codes", token, map[string]string{"code": wrongCode(totpCode(t, secret, 0))})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request(t, http.MethodPost, "/v1/me/mfa/recovery-codes", token, map[string]string{"code": totpCode(t, secret, 0)})
+	assertStatus(t, res, http.StatusOK)
+
+	var body struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	res.decode(t, &body)
+
+	// Regenerating replaces the old codes.
+	res = ts.request(t, http.MethodDelete, "/v1/me/mfa/totp", token, map[string]string{"recovery_code": oldCodes[0]})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request(t, http.MethodDelete, "/v1/me/mfa/totp", token, map[string]string{"recovery_code": body.RecoveryCodes[0]})
+	assertStatus(t, res, http.StatusOK)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusCreated)
+}
+
+func TestManageTOTPWrongCodes(t *testing.T) {
+	endpoints := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodDelete, "/v1/me/mfa/totp"},
+		{http.MethodPost, "/v1/me/mfa/recovery-codes"},
+	}
+
+	for _, e := range endpoints {
+		t.Run(e.method+" "+e.path, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			ts := newTestServer(t, app)
+
+			_, token := newAuthenticatedUser(t, app, "alice@example.com")
+			secret, _ := enableTOTP(t, ts, token)
+
+			// Wrong codes count towards the account lockout, which then
+			// refuses even the right code and the password.
+			for i := 0; i < app.config.login.maxFailures; i++ {
+				res := ts.request(t, e.method, e.path, token, map[string]string{"code": wrongCode(totpCode(t, secret, 0))})
+				assertStatus(t, res, http.StatusUnauthorized)
+			}
+
+			res := ts.request(t, e.method, e.path, token, map[string]string{"code": totpCode(t, secret, 0)})
+			assertStatus(t, res, http.StatusTooManyRequests)
+
+			res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+			assertStatus(t, res, http.StatusTooManyRequests)
+		})
+
+		t.Run(e.method+" "+e.path+" rate limited", func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.limiter.enabled = true
+			app.config.limiter.rps = 100
+			app.config.limiter.burst = 100
+			app.config.login.maxFailures = 10
+			ts := newTestServer(t, app)
+
+			_, token := newAuthenticatedUser(t, app, "alice@example.com")
+			secret, _ := enableTOTP(t, ts, token)
+
+			// The auth group allows a burst of 2.
+			for i := 0; i < 2; i++ {
+				res := ts.request(t, e.method, e.path, token, map[string]string{"code": wrongCode(totpCode(t, secret, 0))})
+				assertStatus(t, res, http.StatusUnauthorized)
+			}
+
+			res := ts.request(t, e.method, e.path, token, map[string]string{"code": wrongCode(totpCode(t, secret, 0))})
+			assertStatus(t, res, http.StatusTooManyRequests)
+
+			if res.header.Get("Retry-After") == "" {
+				t.Error("got no Retry-After header")
+			}
+		})
+	}
+}
+
+// wrongCode returns a six digit code which differs from code.
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
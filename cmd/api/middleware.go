@@ -1,16 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors" 
-	"net"
 	"fmt"
 	"net/http"
 	"strings" 
-	"sync" 
 	"time" 
 	"goproject/pkg/data" 
+	"goproject/pkg/ratelimit"
 	"goproject/pkg/validator" 
-	"golang.org/x/time/rate" 
 )
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -26,65 +25,135 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 })
 }
 
+// requestID tags each request with an ID, reusing the client's X-Request-ID
+// when it looks sane, so a log line can be matched to a client report.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			var err error
+			id, err = newRequestID()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestInfo(r, &requestInfo{id: id})
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRequests writes an access log line for every request once it has been
+// handled.
+func (app *application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		properties := map[string]interface{}{
+			"method": r.Method,
+			"path": r.URL.Path,
+			"status": rec.status,
+			"bytes": rec.bytes,
+			"duration": time.Since(start),
+			"client_ip": app.clientIP(r),
+		}
+
+		if info := app.contextGetRequestInfo(r); info != nil {
+			if info.route != "" {
+				properties["route"] = info.route
+			}
+			if info.user != nil && !info.user.IsAnonymous() {
+				properties["user_id"] = info.user.ID
+			}
+		}
+
+		app.requestLogger(r).PrintInfo("request", properties)
+	})
+}
+
 func (app *application) rateLimit(next http.Handler) http.Handler {
-	type client struct {
-		limiter *rate.Limiter
-		lastSeen time.Time
-	}
-
-	var (
-		mu sync.Mutex
-		clients = make(map[string]*client)
-	)
-
-	go func() {
-		for {
-		time.Sleep(time.Minute)
-		mu.Lock()
-		for ip, client := range clients {
-		if time.Since(client.lastSeen) > 3*time.Minute {
-				delete(clients, ip)
+	if app.config.limiter.enabled {
+		go func() {
+			for {
+				time.Sleep(time.Minute)
+				err := app.limiter.Sweep(context.Background())
+				if err != nil {
+					app.logger.PrintError(err, nil)
 				}
 			}
-			mu.Unlock()
-		}
-	}()
-				
+		}()
+	}
+
+	limit := ratelimit.Limit{Rate: app.config.limiter.rps, Burst: app.config.limiter.burst}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
+			if !app.allowRequest(w, r, "global", limit) {
 				return
 			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			mu.Lock()
+// limitClientIP counts every request against its client IP before it is
+// authenticated. rateLimit counts authenticated requests per user, so without
+// this a client could keep guessing tokens and API keys, each costing a
+// database lookup, without ever being limited. The limit is looser than the
+// global one so that users sharing an address still get their own buckets.
+func (app *application) limitClientIP(next http.Handler) http.Handler {
+	limit := ratelimit.Limit{Rate: app.config.limiter.ipRPS, Burst: app.config.limiter.ipBurst}
 
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
-				}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.limiter.enabled {
+			if !app.allowRequestFor(w, r, "client", "ip:"+app.clientIP(r), limit) {
+				return
 			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			clients[ip].lastSeen = time.Now()
-
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
+// limitRoute applies the route limit configured for group on top of the
+// global limit, for endpoints such as login which need to be stricter.
+func (app *application) limitRoute(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := app.routeLimits[group]
+		if app.config.limiter.enabled && ok {
+			if !app.allowRequest(w, r, group, limit) {
 				return
 			}
-			mu.Unlock()
 		}
 		next.ServeHTTP(w, r)
-		})
+	}
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Vary", "Authorization")
+	w.Header().Add("Vary", "X-API-Key")
 
 	authorizationHeader := r.Header.Get("Authorization")
+	apiKeyHeader := r.Header.Get("X-API-Key")
+
+	if apiKeyHeader != "" {
+		if authorizationHeader != "" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		app.authenticateAPIKey(w, r, apiKeyHeader, next)
+		return
+	}
 
 	if authorizationHeader == "" {
 		r = app.contextSetUser(r, data.AnonymousUser)
@@ -100,6 +169,18 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 	token := headerParts[1]
 
+	if app.jwtKeys != nil && isJWT(token) {
+		user, permissions, err := app.parseJWTAccessToken(token)
+		if err != nil {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		r = app.contextSetUser(r, user)
+		r = app.contextSetPermissions(r, permissions)
+		next.ServeHTTP(w, r)
+		return
+	}
+
 	v := validator.New()
 
 	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -107,7 +188,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -122,6 +203,47 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateAPIKey authenticates a request made with an API key. The
+// request is granted the permissions listed on the key, limited to those its
+// owner still holds.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, keyPlaintext string, next http.Handler) {
+	v := validator.New()
+
+	if data.ValidateAPIKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return
+	}
+
+	key, user, err := app.models.APIKeys.GetForKey(r.Context(), keyPlaintext)
+	if err != nil {
+		switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAPIKeyResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	userPermissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions := data.Permissions{}
+	for _, code := range key.Permissions {
+		if userPermissions.Include(code) {
+			permissions = append(permissions, code)
+		}
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, permissions)
+	r = app.contextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
@@ -148,10 +270,14 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			permissions, err = app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		}
 		if !permissions.Include(code) {
 			app.notPermittedResponse(w, r)
@@ -160,4 +286,17 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		next.ServeHTTP(w, r)
 	}
 	return app.requireActivatedUser(fn)
-}
\ No newline at end of file
+}
+
+// denyAPIKeys rejects requests authenticated with an API key, for endpoints
+// that must only be reachable with a user's own credentials.
+func (app *application) denyAPIKeys(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.requireActivatedUser(fn)
+}
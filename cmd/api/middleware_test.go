@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"goproject/pkg/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	user, token := newAuthenticatedUser(t, app, "reader@example.com", "characters:read", "players:read")
+
+	expired, err := app.models.Tokens.New(context.Background(), user.ID, -time.Minute, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activation, err := app.models.Tokens.New(context.Background(), user.ID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := app.models.APIKeys.New(context.Background(), user.ID, "reports", data.Permissions{"characters:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		want    int
+		wantErr string
+	}{
+		{"no credentials", http.Header{}, http.StatusUnauthorized, "you must be authenticated to access this resource"},
+		{"valid token", http.Header{"Authorization": {"Bearer " + token}}, http.StatusOK, ""},
+		{"not bearer", http.Header{"Authorization": {"Basic " + token}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+		{"missing token", http.Header{"Authorization": {"Bearer"}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+		{"malformed token", http.Header{"Authorization": {"Bearer abc"}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+		{"unknown token", http.Header{"Authorization": {"Bearer " + strings.Repeat("A", 26)}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+		{"expired token", http.Header{"Authorization": {"Bearer " + expired.Plaintext}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+		{"wrong scope", http.Header{"Authorization": {"Bearer " + activation.Plaintext}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+		{"valid api key", http.Header{"X-Api-Key": {key.Plaintext}}, http.StatusOK, ""},
+		{"malformed api key", http.Header{"X-Api-Key": {"nope"}}, http.StatusUnauthorized, "invalid or expired api key"},
+		{"unknown api key", http.Header{"X-Api-Key": {data.APIKeyPrefix + strings.Repeat("A", 26)}}, http.StatusUnauthorized, "invalid or expired api key"},
+		{"api key and token", http.Header{"X-Api-Key": {key.Plaintext}, "Authorization": {"Bearer " + token}}, http.StatusUnauthorized, "invalid or missing authentication token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.requestWithHeader(t, http.MethodGet, "/v1/characters", tt.header, nil)
+			assertStatus(t, res, tt.want)
+
+			if tt.wantErr != "" {
+				if got := res.errorMessage(t); got != tt.wantErr {
+					t.Errorf("got error %q, want %q", got, tt.wantErr)
+				}
+			}
+		})
+	}
+
+	res := ts.request(t, http.MethodGet, "/v1/characters", "abc", nil)
+	if got := res.header.Get("WWW-Authenticate"); got != "Bearer" {
+		t.Errorf("got WWW-Authenticate %q, want %q", got, "Bearer")
+	}
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	keys, err := parseJWTKeys("test:HS256:"+base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jwtKeys = keys
+	app.config.auth.mode = authModeJWT
+
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "jwt@example.com", true, "characters:read")
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "jwt@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusCreated)
+
+	var tokens struct {
+		Access  data.Token `json:"authentication_token"`
+		Refresh data.Token `json:"refresh_token"`
+	}
+	res.decode(t, &tokens)
+
+	if !isJWT(tokens.Access.Plaintext) {
+		t.Fatalf("access token %q is not a JWT", tokens.Access.Plaintext)
+	}
+
+	res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	// Permissions come from the token, not the database.
+	res = ts.request(t, http.MethodGet, "/v1/players", tokens.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusForbidden)
+
+	tampered := tokens.Access.Plaintext[:len(tokens.Access.Plaintext)-2] + "xx"
+	res = ts.request(t, http.MethodGet, "/v1/characters", tampered, nil)
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": tokens.Refresh.Plaintext})
+	assertStatus(t, res, http.StatusCreated)
+}
+
+func TestAPIKeyPermissions(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	user, _ := newAuthenticatedUser(t, app, "keys@example.com", "characters:read", "players:read")
+
+	key, err := app.models.APIKeys.New(context.Background(), user.ID, "characters only", data.Permissions{"characters:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"X-Api-Key": {key.Plaintext}}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/v1/characters", http.StatusOK},
+		{http.MethodGet, "/v1/players", http.StatusForbidden},
+		{http.MethodGet, "/v1/me/api-keys", http.StatusForbidden},
+		{http.MethodPost, "/v1/me/mfa/totp", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			res := ts.requestWithHeader(t, tt.method, tt.path, header, nil)
+			assertStatus(t, res, tt.want)
+		})
+	}
+
+	// A key loses a permission as soon as its owner does.
+	err = app.models.Permissions.RemoveForUser(context.Background(), user.ID, "characters:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := ts.requestWithHeader(t, http.MethodGet, "/v1/characters", header, nil)
+	assertStatus(t, res, http.StatusForbidden)
+}
+
+func TestRateLimit(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 0.01
+	app.config.limiter.burst = 2
+
+	ts := newTestServer(t, app)
+
+	for i := 0; i < 2; i++ {
+		res := ts.request(t, http.MethodGet, "/v1/characters", "", nil)
+		assertStatus(t, res, http.StatusUnauthorized)
+
+		if res.header.Get("RateLimit-Limit") != "2" {
+			t.Errorf("got RateLimit-Limit %q, want 2", res.header.Get("RateLimit-Limit"))
+		}
+	}
+
+	res := ts.request(t, http.MethodGet, "/v1/characters", "", nil)
+	assertStatus(t, res, http.StatusTooManyRequests)
+
+	if res.header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	if got, want := res.errorMessage(t), "rate limit exceeded"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	// Authenticated requests are counted per user, not per address.
+	_, token := newAuthenticatedUser(t, app, "limited@example.com", "characters:read")
+
+	res = ts.request(t, http.MethodGet, "/v1/characters", token, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	// Health checks aren't limited at all.
+	for _, path := range []string{"/v1/healthcheck", "/v1/healthcheck/live", "/v1/healthcheck/ready"} {
+		res = ts.request(t, http.MethodGet, path, "", nil)
+		assertStatus(t, res, http.StatusOK)
+
+		if res.header.Get("RateLimit-Limit") != "" {
+			t.Errorf("%s: got RateLimit-Limit %q, want none", path, res.header.Get("RateLimit-Limit"))
+		}
+	}
+}
+
+func TestRateLimitInvalidCredentials(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 100
+	app.config.limiter.burst = 100
+	app.config.limiter.ipRPS = 0.01
+	app.config.limiter.ipBurst = 3
+
+	ts := newTestServer(t, app)
+
+	header := http.Header{}
+	header.Set("X-API-Key", "notarealkeynotarealkeynotarealkeynotarealkey")
+
+	// Rejected keys never reach the per-user limit, so they have to be
+	// counted against the address.
+	for i := 0; i < 3; i++ {
+		res := ts.requestWithHeader(t, http.MethodGet, "/v1/characters", header, nil)
+		assertStatus(t, res, http.StatusUnauthorized)
+	}
+
+	res := ts.requestWithHeader(t, http.MethodGet, "/v1/characters", header, nil)
+	assertStatus(t, res, http.StatusTooManyRequests)
+}
+
+func TestLimitRoute(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 100
+	app.config.limiter.burst = 100
+
+	ts := newTestServer(t, app)
+
+	// The auth group allows a burst of 2.
+	for i := 0; i < 2; i++ {
+		res := ts.request(t, http.MethodPost, "/v1/tokens/activation", "", map[string]string{"email": "nobody@example.com"})
+		assertStatus(t, res, http.StatusUnprocessableEntity)
+	}
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/activation", "", map[string]string{"email": "nobody@example.com"})
+	assertStatus(t, res, http.StatusTooManyRequests)
+
+	// Other routes only count against the global limit.
+	res = ts.request(t, http.MethodGet, "/v1/characters", "", nil)
+	assertStatus(t, res, http.StatusUnauthorized)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	handler := app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	res := testResponse{status: rec.Code, header: rec.Header(), body: rec.Body.Bytes()}
+	assertStatus(t, res, http.StatusInternalServerError)
+
+	if got := res.header.Get("Connection"); got != "close" {
+		t.Errorf("got Connection %q, want close", got)
+	}
+	if got, want := res.errorMessage(t), "the server encountered a problem and could not process your request"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.requestWithHeader(t, http.MethodGet, "/v1/healthcheck", http.Header{"X-Request-Id": {"client-id-1"}}, nil)
+	if got := res.header.Get("X-Request-ID"); got != "client-id-1" {
+		t.Errorf("got X-Request-ID %q, want the client's", got)
+	}
+
+	res = ts.requestWithHeader(t, http.MethodGet, "/v1/nothing-here", http.Header{"X-Request-Id": {"bad id\n"}}, nil)
+
+	id := res.header.Get("X-Request-ID")
+	if len(id) != 32 {
+		t.Errorf("got X-Request-ID %q, want a generated one", id)
+	}
+
+	var body struct {
+		RequestID string `json:"request_id"`
+	}
+	res.decode(t, &body)
+
+	if body.RequestID != id {
+		t.Errorf("got request_id %q in the error, want %q", body.RequestID, id)
+	}
+}
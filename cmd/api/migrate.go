@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"goproject/pkg/jsonlog"
+	"goproject/pkg/migrations"
+)
+
+const migrateUsage = "usage: migrate up | down [N] | status | goto VERSION"
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, db *sql.DB, logger *jsonlog.Logger, w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	var done []migrations.Migration
+	direction := "applied"
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		done, err = migrator.Up(ctx)
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		direction = "reverted"
+		done, err = migrator.Down(ctx, steps)
+	case args[0] == "goto" && len(args) == 2:
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		done, err = migrator.Goto(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		return printMigrationStatus(ctx, migrator, w)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	// Report what was done even when a later migration failed.
+	logMigrations(logger, done, direction)
+	if err != nil {
+		return err
+	}
+
+	if len(done) == 0 {
+		logger.PrintInfo("schema is up to date", nil)
+	}
+
+	return nil
+}
+
+// autoMigrate applies pending migrations at startup, for -auto-migrate.
+func autoMigrate(db *sql.DB, logger *jsonlog.Logger) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	done, err := migrator.Up(context.Background())
+	logMigrations(logger, done, "applied")
+	return err
+}
+
+func logMigrations(logger *jsonlog.Logger, done []migrations.Migration, direction string) {
+	for _, migration := range done {
+		logger.PrintInfo("migration "+direction, map[string]interface{}{
+			"version": migration.Version,
+			"name":    migration.Name,
+		})
+	}
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrations.Migrator, w io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, s := range statuses {
+		status, appliedAt := "pending", ""
+		switch {
+		case s.Unknown:
+			status = "unknown"
+		case s.Modified:
+			status = "modified"
+		case s.Applied:
+			status = "applied"
+		}
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tw, "%06d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+	}
+
+	return tw.Flush()
+}
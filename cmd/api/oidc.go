@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"goproject/pkg/data"
+	"goproject/pkg/oidc"
+	"goproject/pkg/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/v1/auth/oidc"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var (
+	errInvalidOIDCState    = errors.New("invalid oidc state")
+	errUnverifiedOIDCEmail = errors.New("identity provider did not supply a verified email address")
+	errInvalidOIDCEmail    = errors.New("identity provider supplied an invalid email address")
+	errOIDCEmailInUse      = errors.New("an account with this email address already exists, log in with its password and link this identity to it instead")
+	errOIDCIdentityInUse   = errors.New("this identity is already linked to another account")
+)
+
+// oidcState is kept in a signed cookie between the start and callback
+// requests, so that no server-side session storage is needed. Link is the ID
+// of the user who started linking an identity, or 0 for a login.
+type oidcState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Link     int64  `json:"l,omitempty"`
+	Expires  int64  `json:"e"`
+}
+
+func (app *application) encodeOIDCState(st oidcState) (string, error) {
+	js, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(js)
+
+	mac := hmac.New(sha256.New, app.oidcStateKey)
+	mac.Write([]byte(payload))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (app *application) decodeOIDCState(value string) (*oidcState, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errInvalidOIDCState
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, errInvalidOIDCState
+	}
+
+	mac := hmac.New(sha256.New, app.oidcStateKey)
+	mac.Write([]byte(payload))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errInvalidOIDCState
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidOIDCState
+	}
+
+	var st oidcState
+	err = json.Unmarshal(js, &st)
+	if err != nil {
+		return nil, errInvalidOIDCState
+	}
+
+	if time.Now().Unix() > st.Expires {
+		return nil, errInvalidOIDCState
+	}
+
+	return &st, nil
+}
+
+func (app *application) oidcStartHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	authURL, err := app.startOIDC(w, r, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// linkOIDCIdentityHandler starts linking an identity at the provider to the
+// authenticated user, which is how an account registered with a password
+// gets single sign-on. The client sends the user to the returned URL and
+// completes the callback with the same authentication token.
+func (app *application) linkOIDCIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	authURL, err := app.startOIDC(w, r, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"authorization_url": authURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// startOIDC sets the state cookie for a new login, or for linking an identity
+// to the user with ID link, and returns the provider URL to send the user to.
+func (app *application) startOIDC(w http.ResponseWriter, r *http.Request, link int64) (string, error) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := app.oidc.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	cookie, err := app.encodeOIDCState(oidcState{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Link:     link,
+		Expires:  time.Now().Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     oidcStatePath,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   app.config.env != "development",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return authURL, nil
+}
+
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		app.invalidOIDCStateResponse(w, r)
+		return
+	}
+
+	// The state is single use, whatever the outcome.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcStatePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.config.env != "development",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	st, err := app.decodeOIDCState(cookie.Value)
+	if err != nil || !hmac.Equal([]byte(st.State), []byte(qs.Get("state"))) {
+		app.invalidOIDCStateResponse(w, r)
+		return
+	}
+
+	// A link must be completed by the user who started it, so that a stolen
+	// state cookie can't attach an identity to their account.
+	if st.Link != 0 {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() || app.contextGetAPIKey(r) != nil {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		if user.ID != st.Link {
+			app.invalidOIDCStateResponse(w, r)
+			return
+		}
+	}
+
+	if providerError := qs.Get("error"); providerError != "" {
+		app.oidcLoginFailedResponse(w, r, "the identity provider reported an error: "+providerError)
+		return
+	}
+
+	code := qs.Get("code")
+	if code == "" {
+		app.badRequestResponse(w, r, errors.New("missing code parameter"))
+		return
+	}
+
+	identity, err := app.oidc.Exchange(r.Context(), code, st.Verifier, st.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			app.logError(r, err)
+			app.oidcLoginFailedResponse(w, r, "the identity provider returned an invalid identity")
+		case errors.Is(err, oidc.ErrCodeRejected):
+			app.logError(r, err)
+			app.oidcLoginFailedResponse(w, r, "the identity provider rejected the login, please start again")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if st.Link != 0 {
+		app.linkOIDCIdentity(w, r, identity)
+		return
+	}
+
+	user, err := app.userForIdentity(r.Context(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedOIDCEmail), errors.Is(err, errInvalidOIDCEmail), errors.Is(err, errOIDCEmailInUse):
+			app.oidcLoginFailedResponse(w, r, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The provider only stands in for the password, so a user with two-factor
+	// authentication still has to complete it.
+	enrollment, err := app.models.MFA.GetTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if enrollment != nil && enrollment.Confirmed {
+		app.mfaChallengeResponse(w, r, user)
+		return
+	}
+
+	env, err := app.issueAuthenticationTokens(r.Context(), user, "")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// linkOIDCIdentity attaches identity to the authenticated user, unless it is
+// already linked to someone else.
+func (app *application) linkOIDCIdentity(w http.ResponseWriter, r *http.Request, identity *oidc.Identity) {
+	user := app.contextGetUser(r)
+	provider := app.oidc.Name()
+
+	err := app.models.Identities.Insert(r.Context(), provider, identity.Subject, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Insert keeps an existing link, so check who the identity belongs to.
+	owner, err := app.models.Identities.GetUser(r.Context(), provider, identity.Subject)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if owner.ID != user.ID {
+		app.errorResponse(w, r, http.StatusConflict, errOIDCIdentityInUse.Error())
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "identity linked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// userForIdentity finds the user linked to an external identity. Identities
+// seen for the first time are linked to a newly provisioned user with the
+// default permissions. An existing account with the same email address is
+// never taken over, since it may have been registered by someone else and
+// a match on the address alone doesn't prove it belongs to the same person.
+func (app *application) userForIdentity(ctx context.Context, identity *oidc.Identity) (*data.User, error) {
+	provider := app.oidc.Name()
+
+	user, err := app.models.Identities.GetUser(ctx, provider, identity.Subject)
+	switch {
+	case err == nil:
+		return user, nil
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errUnverifiedOIDCEmail
+	}
+
+	err = app.models.WithTx(ctx, func(tx data.Models) error {
+		var err error
+		user, err = provisionOIDCUser(ctx, tx, identity)
+		if err != nil {
+			return err
+		}
+
+		return tx.Identities.Insert(ctx, provider, identity.Subject, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func provisionOIDCUser(ctx context.Context, models data.Models, identity *oidc.Identity) (*data.User, error) {
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+	if len(name) > 500 {
+		name = name[:500]
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     identity.Email,
+		Activated: true,
+	}
+
+	// The user logs in through the provider, so the password is random and
+	// never revealed. A password reset can still set a real one.
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return nil, errInvalidOIDCEmail
+	}
+
+	err = models.Users.Insert(ctx, user)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			return nil, errOIDCEmailInUse
+		}
+		return nil, err
+	}
+
+	err = models.Permissions.AddForUser(ctx, user.ID, data.DefaultPermissions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
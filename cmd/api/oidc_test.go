@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"goproject/pkg/data"
+	"goproject/pkg/oidc"
+	"goproject/pkg/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func newOIDCTestServer(t *testing.T, user oidctest.User) (*testServer, *oidctest.Server) {
+	t.Helper()
+
+	stub := oidctest.NewServer("test-client", user)
+	t.Cleanup(stub.Close)
+
+	app, _ := newTestApplication(t)
+	app.oidc = oidc.New(oidc.Config{
+		Name:         "stub",
+		Issuer:       stub.URL,
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://localhost/v1/auth/oidc/callback",
+	})
+
+	return newTestServer(t, app), stub
+}
+
+// startOIDCLogin begins a login and follows the provider's redirect, returning
+// the state cookie and the query the provider sent back to the callback.
+func startOIDCLogin(t *testing.T, ts *testServer) (string, url.Values) {
+	t.Helper()
+
+	res := ts.request(t, http.MethodGet, "/v1/auth/oidc/start", "", nil)
+	assertStatus(t, res, http.StatusFound)
+
+	cookies := (&http.Response{Header: res.header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %+v, want the state cookie", cookies)
+	}
+
+	return oidcStateCookie + "=" + cookies[0].Value, followOIDCProvider(t, res.header.Get("Location"))
+}
+
+// startOIDCLink begins linking an identity to the user with token, the same
+// way as startOIDCLogin.
+func startOIDCLink(t *testing.T, ts *testServer, token string) (string, url.Values) {
+	t.Helper()
+
+	res := ts.request(t, http.MethodPost, "/v1/me/identities/oidc", token, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	cookies := (&http.Response{Header: res.header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %+v, want the state cookie", cookies)
+	}
+
+	var body struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	res.decode(t, &body)
+
+	return oidcStateCookie + "=" + cookies[0].Value, followOIDCProvider(t, body.AuthorizationURL)
+}
+
+// followOIDCProvider logs in at the stub provider and returns the query it
+// sent back to the callback.
+func followOIDCProvider(t *testing.T, authURL string) url.Values {
+	t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("provider returned %d", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return callback.Query()
+}
+
+func finishOIDCLogin(t *testing.T, ts *testServer, cookie string, query url.Values) testResponse {
+	t.Helper()
+
+	return finishOIDCLink(t, ts, cookie, "", query)
+}
+
+func finishOIDCLink(t *testing.T, ts *testServer, cookie, token string, query url.Values) testResponse {
+	t.Helper()
+
+	header := http.Header{}
+	if cookie != "" {
+		header.Set("Cookie", cookie)
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return ts.requestWithHeader(t, http.MethodGet, "/v1/auth/oidc/callback?"+query.Encode(), header, nil)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ts, _ := newOIDCTestServer(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	cookie, query := startOIDCLogin(t, ts)
+
+	res := finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusCreated)
+
+	var tokens tokenPair
+	res.decode(t, &tokens)
+
+	// New users get the default permissions.
+	res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	user, err := ts.app.models.Users.GetByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Activated || user.Name != "Alice" {
+		t.Errorf("got user %+v", user)
+	}
+
+	// The provider only accepts each code once.
+	res = finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	cookie, query = startOIDCLogin(t, ts)
+
+	res = finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusCreated)
+
+	users, err := ts.app.models.Users.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Errorf("got %d users after logging in twice, want 1", len(users))
+	}
+}
+
+func TestOIDCRefusesExistingEmail(t *testing.T) {
+	ts, _ := newOIDCTestServer(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	existing := createTestUser(t, ts.app, "alice@example.com", false)
+
+	cookie, query := startOIDCLogin(t, ts)
+
+	res := finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	if got, want := res.errorMessage(t), errOIDCEmailInUse.Error(); got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	_, err := ts.app.models.Identities.GetUser(context.Background(), "stub", "alice-1")
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("got error %v looking up the identity, want it left unlinked", err)
+	}
+
+	user, err := ts.app.models.Users.Get(context.Background(), existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Activated {
+		t.Error("got the existing user activated, want it left alone")
+	}
+}
+
+func TestOIDCLink(t *testing.T) {
+	ts, _ := newOIDCTestServer(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	alice, token := newAuthenticatedUser(t, ts.app, "alice@example.com", "characters:read")
+
+	cookie, query := startOIDCLink(t, ts, token)
+
+	res := finishOIDCLink(t, ts, cookie, token, query)
+	assertStatus(t, res, http.StatusOK)
+
+	user, err := ts.app.models.Identities.GetUser(context.Background(), "stub", "alice-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Errorf("got identity linked to user %d, want %d", user.ID, alice.ID)
+	}
+
+	// Logging in through the provider now reaches the existing account.
+	cookie, query = startOIDCLogin(t, ts)
+
+	res = finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusCreated)
+
+	var tokens tokenPair
+	res.decode(t, &tokens)
+
+	res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	users, err := ts.app.models.Users.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Errorf("got %d users, want 1", len(users))
+	}
+
+	// Linking again is harmless.
+	cookie, query = startOIDCLink(t, ts, token)
+
+	res = finishOIDCLink(t, ts, cookie, token, query)
+	assertStatus(t, res, http.StatusOK)
+}
+
+func TestOIDCLinkErrors(t *testing.T) {
+	ts, _ := newOIDCTestServer(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	_, alice := newAuthenticatedUser(t, ts.app, "alice@example.com")
+	bob, bobToken := newAuthenticatedUser(t, ts.app, "bob@example.com")
+
+	cookie, query := startOIDCLink(t, ts, alice)
+
+	// The callback has to be made by the user who started the link.
+	res := finishOIDCLink(t, ts, cookie, "", query)
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	if got, want := res.errorMessage(t), "you must be authenticated to access this resource"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	res = finishOIDCLink(t, ts, cookie, bobToken, query)
+	assertStatus(t, res, http.StatusBadRequest)
+
+	if got, want := res.errorMessage(t), "invalid or expired login state, please start the login again"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	_, err := ts.app.models.Identities.GetUser(context.Background(), "stub", "alice-1")
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("got error %v looking up the identity, want it left unlinked", err)
+	}
+
+	// An identity already linked to someone else stays with them.
+	err = ts.app.models.Identities.Insert(context.Background(), "stub", "alice-1", bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie, query = startOIDCLink(t, ts, alice)
+
+	res = finishOIDCLink(t, ts, cookie, alice, query)
+	assertStatus(t, res, http.StatusConflict)
+
+	if got, want := res.errorMessage(t), errOIDCIdentityInUse.Error(); got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	user, err := ts.app.models.Identities.GetUser(context.Background(), "stub", "alice-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != bob.ID {
+		t.Errorf("got identity linked to user %d, want %d", user.ID, bob.ID)
+	}
+}
+
+func TestOIDCLoginWithTOTP(t *testing.T) {
+	ts, _ := newOIDCTestServer(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	cookie, query := startOIDCLogin(t, ts)
+
+	res := finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusCreated)
+
+	var tokens tokenPair
+	res.decode(t, &tokens)
+
+	secret, _ := enableTOTP(t, ts, tokens.Access.Plaintext)
+
+	cookie, query = startOIDCLogin(t, ts)
+
+	res = finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusOK)
+
+	var body struct {
+		MFARequired bool `json:"mfa_required"`
+		MFAToken    struct {
+			Plaintext string `json:"token"`
+		} `json:"mfa_token"`
+		AccessToken any `json:"authentication_token"`
+	}
+	res.decode(t, &body)
+
+	if !body.MFARequired || body.MFAToken.Plaintext == "" || body.AccessToken != nil {
+		t.Fatalf("got %s, want an mfa challenge and no tokens", res.body)
+	}
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication/mfa", "", map[string]string{"mfa_token": body.MFAToken.Plaintext, "code": totpCode(t, secret, 0)})
+	assertStatus(t, res, http.StatusCreated)
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	ts, stub := newOIDCTestServer(t, oidctest.User{Subject: "mallory-1", Email: "mallory@example.com", EmailVerified: false})
+
+	cookie, query := startOIDCLogin(t, ts)
+
+	with := func(key, value string) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if value == "" {
+			q.Del(key)
+		} else {
+			q.Set(key, value)
+		}
+		return q
+	}
+
+	tests := []struct {
+		name      string
+		cookie    string
+		query     url.Values
+		want      int
+		wantError string
+	}{
+		{"no cookie", "", query, http.StatusBadRequest, "invalid or expired login state, please start the login again"},
+		{"forged cookie", oidcStateCookie + "=forged.value", query, http.StatusBadRequest, "invalid or expired login state, please start the login again"},
+		{"wrong state", cookie, with("state", "other"), http.StatusBadRequest, "invalid or expired login state, please start the login again"},
+		{"provider error", cookie, with("error", "access_denied"), http.StatusUnauthorized, "the identity provider reported an error: access_denied"},
+		{"missing code", cookie, with("code", ""), http.StatusBadRequest, "missing code parameter"},
+		{"unverified email", cookie, query, http.StatusUnauthorized, errUnverifiedOIDCEmail.Error()},
+		{"code reused", cookie, query, http.StatusUnauthorized, "the identity provider rejected the login, please start again"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := finishOIDCLogin(t, ts, tt.cookie, tt.query)
+			assertStatus(t, res, tt.want)
+
+			if got := res.errorMessage(t); got != tt.wantError {
+				t.Errorf("got error %q, want %q", got, tt.wantError)
+			}
+		})
+	}
+
+	stub.SetUser(oidctest.User{Subject: "mallory-1", Email: "not-an-email", EmailVerified: true})
+
+	cookie, query = startOIDCLogin(t, ts)
+
+	res := finishOIDCLogin(t, ts, cookie, query)
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	if got, want := res.errorMessage(t), errInvalidOIDCEmail.Error(); got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+}
@@ -38,9 +38,9 @@ func (app *application) createPlayerHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 
-	err = app.models.Players.Insert(player)
+	err = app.models.Players.Insert(r.Context(), player)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		app.databaseErrorResponse(w, r, err)
 		return
 	}
 	
@@ -61,7 +61,7 @@ func (app *application) showPlayerHandler(w http.ResponseWriter, r *http.Request
 		return
 	}		
 
-	player, err := app.models.Players.Get(playerid)
+	player, err := app.models.Players.Get(r.Context(), playerid)
 	if err != nil {
 	switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -84,7 +84,7 @@ func (app *application) updatePlayerHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	player, err := app.models.Players.Get(playerid)
+	player, err := app.models.Players.Get(r.Context(), playerid)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -131,13 +131,13 @@ func (app *application) updatePlayerHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Players.Update(player)
+	err = app.models.Players.Update(r.Context(), player)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrEditConflict):
 				app.editConflictResponse(w, r)
 			default:
-				app.serverErrorResponse(w, r, err)
+				app.databaseErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -155,7 +155,7 @@ func (app *application) deletePlayerHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Players.Delete(playerid)
+	err = app.models.Players.Delete(r.Context(), playerid)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -197,7 +197,7 @@ func (app *application) listPlayersHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	
-	players, metadata,err := app.models.Players.GetAll(input.Nickname, input.Roles, input.Filters)
+	players, metadata,err := app.models.Players.GetAll(r.Context(), input.Nickname, input.Roles, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"goproject/pkg/data"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCreatePlayer(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "writer@example.com", "players:read", "players:write")
+
+	tests := []struct {
+		name      string
+		body      interface{}
+		want      int
+		wantField string
+		wantError string
+	}{
+		{"valid", map[string]interface{}{"nicknames": "Miracle", "mmr": 9000, "winrate": 60, "totalmatches": 5000, "roles": []string{"Carry"}}, http.StatusCreated, "", ""},
+		{"missing nickname", map[string]interface{}{"mmr": 9000, "winrate": 60, "roles": []string{"Carry"}}, http.StatusUnprocessableEntity, "Nickname", "must be provided"},
+		{"negative mmr", map[string]interface{}{"nicknames": "N0tail", "mmr": -5, "winrate": 55, "roles": []string{"Support"}}, http.StatusUnprocessableEntity, "MMR", "must be greater than 0"},
+		{"missing winrate", map[string]interface{}{"nicknames": "N0tail", "mmr": 7000, "roles": []string{"Support"}}, http.StatusUnprocessableEntity, "WinRate", "must be provided"},
+		{"no roles", map[string]interface{}{"nicknames": "N0tail", "mmr": 7000, "winrate": 55, "roles": []string{}}, http.StatusUnprocessableEntity, "Roles", "must contain at least 1 genre"},
+		{"unknown field", map[string]interface{}{"nicknames": "N0tail", "team": "OG"}, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/players", token, tt.body)
+			assertStatus(t, res, tt.want)
+
+			if tt.wantField != "" {
+				if got := res.errorField(t, tt.wantField); got != tt.wantError {
+					t.Errorf("got %s error %q, want %q", tt.wantField, got, tt.wantError)
+				}
+			}
+
+			if tt.want == http.StatusCreated {
+				var body struct {
+					Player data.Player `json:"player"`
+				}
+				res.decode(t, &body)
+
+				if got, want := res.header.Get("Location"), fmt.Sprintf("/v1/players/%d", body.Player.PlayerID); got != want {
+					t.Errorf("got Location %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestShowUpdateDeletePlayer(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "writer@example.com", "players:read", "players:write")
+	player := createTestPlayer(t, app, "Miracle", 9000, "Carry")
+
+	path := fmt.Sprintf("/v1/players/%d", player.PlayerID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"show", http.MethodGet, path, nil, http.StatusOK},
+		{"show missing", http.MethodGet, "/v1/players/999", nil, http.StatusNotFound},
+		{"show bad id", http.MethodGet, "/v1/players/abc", nil, http.StatusNotFound},
+		{"update", http.MethodPatch, path, map[string]interface{}{"mmr": 9500}, http.StatusOK},
+		{"update invalid", http.MethodPatch, path, map[string]interface{}{"roles": []string{"Carry", "Carry"}}, http.StatusUnprocessableEntity},
+		{"update missing", http.MethodPatch, "/v1/players/999", map[string]interface{}{"mmr": 9500}, http.StatusNotFound},
+		{"update bad body", http.MethodPatch, path, `{"mmr": 9500`, http.StatusBadRequest},
+		{"delete", http.MethodDelete, path, nil, http.StatusOK},
+		{"delete again", http.MethodDelete, path, nil, http.StatusNotFound},
+		{"show deleted", http.MethodGet, path, nil, http.StatusNotFound},
+	}
+
+	// The cases run in order, each seeing the effects of the last.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, tt.method, tt.path, token, tt.body)
+			assertStatus(t, res, tt.want)
+
+			if tt.name == "update" {
+				var body struct {
+					Player data.Player `json:"player"`
+				}
+				res.decode(t, &body)
+
+				if body.Player.MMR != 9500 || body.Player.Nickname != "Miracle" {
+					t.Errorf("got player %+v", body.Player)
+				}
+			}
+		})
+	}
+}
+
+func TestListPlayers(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "reader@example.com", "players:read")
+
+	createTestPlayer(t, app, "Miracle", 9000, "Carry")
+	createTestPlayer(t, app, "N0tail", 7000, "Support")
+	createTestPlayer(t, app, "Puppey", 8000, "Support", "Captain")
+
+	tests := []struct {
+		query         string
+		want          int
+		wantNicknames []string
+		wantTotal     int
+	}{
+		{"", http.StatusOK, []string{"Miracle", "N0tail", "Puppey"}, 3},
+		{"?sort=-mmr", http.StatusOK, []string{"Miracle", "Puppey", "N0tail"}, 3},
+		{"?roles=Support", http.StatusOK, []string{"N0tail", "Puppey"}, 2},
+		{"?nicknames=puppey", http.StatusOK, []string{"Puppey"}, 1},
+		{"?page=2&page_size=2", http.StatusOK, []string{"Puppey"}, 3},
+		{"?sort=team", http.StatusUnprocessableEntity, nil, 0},
+		{"?page_size=0", http.StatusUnprocessableEntity, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res := ts.request(t, http.MethodGet, "/v1/players"+tt.query, token, nil)
+			assertStatus(t, res, tt.want)
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Players  []data.Player `json:"players"`
+				Metadata data.Metadata `json:"metadata"`
+			}
+			res.decode(t, &body)
+
+			nicknames := []string{}
+			for _, player := range body.Players {
+				nicknames = append(nicknames, player.Nickname)
+			}
+
+			if !slices.Equal(nicknames, tt.wantNicknames) {
+				t.Errorf("got %v, want %v", nicknames, tt.wantNicknames)
+			}
+			if body.Metadata.TotalRecords != tt.wantTotal {
+				t.Errorf("got %d total records, want %d", body.Metadata.TotalRecords, tt.wantTotal)
+			}
+		})
+	}
+}
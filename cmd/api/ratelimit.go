@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"goproject/pkg/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRouteLimits parses a comma-separated list of group=rps:burst entries,
+// such as "auth=0.2:5".
+func parseRouteLimits(spec string) (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		group, value, ok := strings.Cut(entry, "=")
+		rps, burst, ok2 := strings.Cut(value, ":")
+		if !ok || !ok2 || group == "" {
+			return nil, fmt.Errorf("route limit %q must be in the form group=rps:burst", entry)
+		}
+
+		limit, err := parseLimit(rps, burst)
+		if err != nil {
+			return nil, fmt.Errorf("route limit %q: %w", entry, err)
+		}
+
+		limits[group] = limit
+	}
+
+	return limits, nil
+}
+
+func parseLimit(rps, burst string) (ratelimit.Limit, error) {
+	rate, err := strconv.ParseFloat(rps, 64)
+	if err != nil || rate <= 0 {
+		return ratelimit.Limit{}, fmt.Errorf("rps must be a positive number")
+	}
+
+	n, err := strconv.Atoi(burst)
+	if err != nil || n < 1 {
+		return ratelimit.Limit{}, fmt.Errorf("burst must be a positive integer")
+	}
+
+	return ratelimit.Limit{Rate: rate, Burst: n}, nil
+}
+
+// rateLimitKey identifies who a request is counted against: the API key or
+// user when the request is authenticated, and the client IP otherwise, so
+// users behind a shared address don't share a bucket.
+func (app *application) rateLimitKey(r *http.Request) string {
+	if key := app.contextGetAPIKey(r); key != nil {
+		return fmt.Sprintf("api-key:%d", key.ID)
+	}
+
+	user := app.contextGetUser(r)
+	if !user.IsAnonymous() {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+
+	return "ip:" + app.clientIP(r)
+}
+
+// allowRequest counts the request against the named bucket and sets the
+// RateLimit headers. When the request is refused, or the limiter fails, the
+// response has already been sent and false is returned.
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, bucket string, limit ratelimit.Limit) bool {
+	return app.allowRequestFor(w, r, bucket, app.rateLimitKey(r), limit)
+}
+
+// allowRequestFor is allowRequest for an explicit key, for use before the
+// request has been authenticated.
+func (app *application) allowRequestFor(w http.ResponseWriter, r *http.Request, bucket, key string, limit ratelimit.Limit) bool {
+	res, err := app.limiter.Allow(r.Context(), bucket+":"+key, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+	if !res.Allowed {
+		app.metrics.rateLimited.WithLabelValues(bucket).Inc()
+		app.rateLimitExceededResponse(w, r, res.RetryAfter)
+		return false
+	}
+
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -6,18 +6,21 @@ import (
 )
 
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	router := patternRouter{httprouter.New()}
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/admin/log-level", app.requirePermission("admin:logging", app.showLogLevelHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/log-level", app.requirePermission("admin:logging", app.updateLogLevelHandler))
 	
 	router.HandlerFunc(http.MethodGet, "/v1/characters", app.requirePermission("characters:read",app.listCharactersHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/characters", app.requirePermission("characters:write",app.createCharacterHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/characters/:id", app.requirePermission("characters:read",app.showCharacterHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/characters/:id", app.requirePermission("characters:write",app.updateCharacterHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/characters/:id", app.requirePermission("characters:write",app.deleteCharacterHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/characters/:id/:slug", app.bySlug("/v1/characters/by-slug/:slug", app.requirePermission("characters:read",app.showCharacterBySlugHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/characters/:id/:slug", app.bySlug("/v1/characters/by-slug/:slug", app.requirePermission("characters:write",app.replaceCharacterBySlugHandler)))
 	
 	router.HandlerFunc(http.MethodGet, "/v1/players", app.requirePermission("players:read",app.listPlayersHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/players", app.requirePermission("players:write",app.createPlayerHandler))
@@ -26,13 +29,54 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodDelete, "/v1/players/:id",app.requirePermission("players:write",app.deletePlayerHandler))
 
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.limitRoute("auth", app.registerUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.limitRoute("auth", app.activateUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.limitRoute("auth", app.updateUserPasswordHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/unlocked", app.limitRoute("auth", app.unlockUserHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/me/api-keys", app.denyAPIKeys(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/me/api-keys", app.denyAPIKeys(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/me/api-keys/:id", app.denyAPIKeys(app.deleteAPIKeyHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/me/mfa/totp", app.denyAPIKeys(app.enrollTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/me/mfa/totp/confirm", app.denyAPIKeys(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/me/mfa/totp", app.limitRoute("auth", app.denyAPIKeys(app.disableTOTPHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/me/mfa/recovery-codes", app.limitRoute("auth", app.denyAPIKeys(app.regenerateRecoveryCodesHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/me/identities/oidc", app.limitRoute("auth", app.denyAPIKeys(app.linkOIDCIdentityHandler)))
 
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/auth/oidc/start", app.limitRoute("auth", app.oidcStartHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/auth/oidc/callback", app.limitRoute("auth", app.oidcCallbackHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.limitRoute("auth", app.createAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/mfa", app.limitRoute("auth", app.createMFAAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.limitRoute("auth", app.refreshAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.limitRoute("auth", app.createActivationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.limitRoute("auth", app.createPasswordResetTokenHandler))
 	
-	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+	api := app.limitClientIP(app.authenticate(app.rateLimit(router)))
+
+	// Health checks are answered before the rate limiters, so that a busy
+	// client can't get an instance taken out of service. Anything else falls
+	// through to the API.
+	probes := patternRouter{httprouter.New()}
+
+	probes.NotFound = api
+	probes.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
+	probes.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	probes.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.liveHandler)
+	probes.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readyHandler)
+
+	return app.requestID(app.logRequests(app.instrument(app.trace(app.recoverPanic(probes)))))
+}
+
+// metricsRoutes serves /metrics on the listener set with -metrics-addr, so it
+// isn't reachable, or rate limited, on the public port.
+func (app *application) metricsRoutes() http.Handler {
+	router := httprouter.New()
+
+	router.Handler(http.MethodGet, "/metrics", app.metrics.handler())
+
+	return router
 }
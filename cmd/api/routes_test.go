@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// routeTest is a request to one route in routes() and the status expected
+// before any handler logic runs.
+type routeTest struct {
+	method string
+	path   string
+	want   int
+}
+
+// protectedRoutes are the routes which need an activated user. Those listed
+// with a permission also need that permission.
+var protectedRoutes = []struct {
+	method     string
+	path       string
+	permission string
+}{
+	{http.MethodGet, "/v1/admin/log-level", "admin:logging"},
+	{http.MethodPut, "/v1/admin/log-level", "admin:logging"},
+	{http.MethodGet, "/v1/characters", "characters:read"},
+	{http.MethodPost, "/v1/characters", "characters:write"},
+	{http.MethodGet, "/v1/characters/1", "characters:read"},
+	{http.MethodPatch, "/v1/characters/1", "characters:write"},
+	{http.MethodDelete, "/v1/characters/1", "characters:write"},
+	{http.MethodGet, "/v1/characters/by-slug/axe", "characters:read"},
+	{http.MethodPut, "/v1/characters/by-slug/axe", "characters:write"},
+	{http.MethodGet, "/v1/players", "players:read"},
+	{http.MethodPost, "/v1/players", "players:write"},
+	{http.MethodGet, "/v1/players/1", "players:read"},
+	{http.MethodPatch, "/v1/players/1", "players:write"},
+	{http.MethodDelete, "/v1/players/1", "players:write"},
+	{http.MethodGet, "/v1/me/api-keys", ""},
+	{http.MethodPost, "/v1/me/api-keys", ""},
+	{http.MethodDelete, "/v1/me/api-keys/1", ""},
+	{http.MethodPost, "/v1/me/mfa/totp", ""},
+	{http.MethodPost, "/v1/me/mfa/totp/confirm", ""},
+	{http.MethodDelete, "/v1/me/mfa/totp", ""},
+	{http.MethodPost, "/v1/me/mfa/recovery-codes", ""},
+	{http.MethodPost, "/v1/me/identities/oidc", ""},
+}
+
+func TestRoutesAnonymous(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	tests := []routeTest{
+		{http.MethodGet, "/v1/healthcheck", http.StatusOK},
+		{http.MethodGet, "/v1/healthcheck/live", http.StatusOK},
+		{http.MethodGet, "/v1/healthcheck/ready", http.StatusOK},
+		{http.MethodGet, "/metrics", http.StatusNotFound},
+		{http.MethodPost, "/v1/users", http.StatusBadRequest},
+		{http.MethodPut, "/v1/users/activated", http.StatusBadRequest},
+		{http.MethodPut, "/v1/users/password", http.StatusBadRequest},
+		{http.MethodPut, "/v1/users/unlocked", http.StatusBadRequest},
+		{http.MethodGet, "/v1/auth/oidc/start", http.StatusNotFound},
+		{http.MethodGet, "/v1/auth/oidc/callback", http.StatusNotFound},
+		{http.MethodPost, "/v1/tokens/authentication", http.StatusBadRequest},
+		{http.MethodPost, "/v1/tokens/authentication/mfa", http.StatusBadRequest},
+		{http.MethodPost, "/v1/tokens/refresh", http.StatusBadRequest},
+		{http.MethodPost, "/v1/tokens/activation", http.StatusBadRequest},
+		{http.MethodPost, "/v1/tokens/password-reset", http.StatusBadRequest},
+		{http.MethodGet, "/v1/nothing-here", http.StatusNotFound},
+		{http.MethodPatch, "/v1/healthcheck", http.StatusMethodNotAllowed},
+	}
+
+	for _, route := range protectedRoutes {
+		tests = append(tests, routeTest{route.method, route.path, http.StatusUnauthorized})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			res := ts.request(t, tt.method, tt.path, "", nil)
+			assertStatus(t, res, tt.want)
+		})
+	}
+}
+
+func TestRoutesInactiveUser(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	user := createTestUser(t, app, "inactive@example.com", false, "characters:read", "characters:write", "players:read", "players:write", "admin:logging")
+	token := authToken(t, app, user)
+
+	for _, route := range protectedRoutes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			res := ts.request(t, route.method, route.path, token, nil)
+			assertStatus(t, res, http.StatusForbidden)
+
+			if got, want := res.errorMessage(t), "your user account must be activated to access this resource"; got != want {
+				t.Errorf("got error %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRoutesWithoutPermission(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := newAuthenticatedUser(t, app, "nobody@example.com")
+
+	for _, route := range protectedRoutes {
+		if route.permission == "" {
+			continue
+		}
+
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			res := ts.request(t, route.method, route.path, token, nil)
+			assertStatus(t, res, http.StatusForbidden)
+
+			if got, want := res.errorMessage(t), "your user account doesn't have the necessary permissions to access this resource"; got != want {
+				t.Errorf("got error %q, want %q", got, want)
+			}
+		})
+	}
+}
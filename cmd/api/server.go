@@ -4,6 +4,7 @@ import (
 	"context" 
 	"errors" 
 	"fmt"
+	"log"
 	"net/http"
 	"os" 
 	"os/signal" 
@@ -15,33 +16,69 @@ func (app *application) serve() error {
 	srv := &http.Server{
 		Addr: fmt.Sprintf(":%d", app.config.port),
 		Handler: app.routes(),
+		ErrorLog: log.New(app.logger, "", 0),
 		IdleTimeout: time.Minute,
 		ReadTimeout: 10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
+	var metricsSrv *http.Server
+	if app.config.metrics.addr != "" {
+		metricsSrv = &http.Server{
+			Addr: app.config.metrics.addr,
+			Handler: app.metricsRoutes(),
+			ErrorLog: log.New(app.logger, "", 0),
+			IdleTimeout: time.Minute,
+			ReadTimeout: 10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			app.logger.PrintInfo("starting metrics server", map[string]interface{}{
+				"addr": metricsSrv.Addr,
+			})
+
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintFatal(err, nil)
+			}
+		}()
+	}
+
 	shutdownError := make(chan error)
 	go func() {
 			quit := make(chan os.Signal, 1)
 			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 			s := <-quit
-			app.logger.PrintInfo("shutting down server", map[string]string{
+			app.logger.PrintInfo("shutting down server", map[string]interface{}{
 			"signal": s.String(),
 		})
+		app.shuttingDown.Store(true)
+		app.drainDelay()
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
 		}
-	app.logger.PrintInfo("completing background tasks", map[string]string{
+
+		// Metrics stay up until the API has stopped, so the last scrapes
+		// still see the drain.
+		if metricsSrv != nil {
+			err = metricsSrv.Shutdown(ctx)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	app.logger.PrintInfo("completing background tasks", map[string]interface{}{
 		"addr": srv.Addr,
 	})
 	app.wg.Wait()
 	shutdownError <- nil
 	}()
 
-	app.logger.PrintInfo("starting server", map[string]string{
+	app.logger.PrintInfo("starting server", map[string]interface{}{
 		"addr": srv.Addr,
 		"env": app.config.env,
 	})
@@ -56,7 +93,7 @@ func (app *application) serve() error {
 		return err
 	}
 
-	app.logger.PrintInfo("stopped server", map[string]string{
+	app.logger.PrintInfo("stopped server", map[string]interface{}{
 		"addr": srv.Addr,
 	})
 	
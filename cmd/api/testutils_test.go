@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"goproject/pkg/data"
+	"goproject/pkg/jsonlog"
+	"goproject/pkg/ratelimit"
+	"goproject/pkg/realip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPassword = "pa55word1234"
+
+// testMailer records mail instead of sending it.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []testMail
+}
+
+type testMail struct {
+	recipient string
+	template  string
+	data      map[string]interface{}
+}
+
+func (m *testMailer) Send(recipient, templateFile string, data interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fields, _ := data.(map[string]interface{})
+	m.sent = append(m.sent, testMail{recipient: recipient, template: templateFile, data: fields})
+	return nil
+}
+
+func (m *testMailer) messages() []testMail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]testMail(nil), m.sent...)
+}
+
+// newTestApplication returns an application backed by empty in-memory models
+// and a capturing mailer. The rate limiter is off, and login backoff is zero
+// so failed logins only count towards a lockout; tests which need either
+// change app.config before calling newTestServer.
+func newTestApplication(t *testing.T) (*application, *testMailer) {
+	t.Helper()
+
+	var cfg config
+	cfg.env = "development"
+	cfg.storage = "memory"
+	cfg.health.timeout = time.Second
+	cfg.limiter.rps = 2
+	cfg.limiter.burst = 4
+	cfg.limiter.ipRPS = 20
+	cfg.limiter.ipBurst = 40
+	cfg.limiter.store = "memory"
+	cfg.auth.mode = authModeOpaque
+	cfg.auth.accessTokenTTL = 15 * time.Minute
+	cfg.auth.refreshTokenTTL = 24 * time.Hour
+	cfg.login.maxFailures = 3
+	cfg.login.ipMaxFailures = 50
+	cfg.login.lockout = 15 * time.Minute
+	cfg.totp.issuer = "Test"
+	cfg.totp.challengeTTL = 5 * time.Minute
+	cfg.jwt.issuer = "test"
+
+	ipResolver, err := realip.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routeLimits, err := parseRouteLimits("auth=0.2:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := &testMailer{}
+
+	app := &application{
+		config:       cfg,
+		logger:       jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models:       data.NewMemoryModels(),
+		mailer:       mailer,
+		metrics:      newMetrics(nil),
+		ipResolver:   ipResolver,
+		limiter:      ratelimit.NewMemory(),
+		routeLimits:  routeLimits,
+		oidcStateKey: []byte("0123456789abcdef0123456789abcdef"),
+	}
+
+	return app, mailer
+}
+
+type testServer struct {
+	app     *application
+	handler http.Handler
+}
+
+// newTestServer wraps app.routes(). Requests are served in process through
+// an httptest.ResponseRecorder.
+func newTestServer(t *testing.T, app *application) *testServer {
+	t.Helper()
+	return &testServer{app: app, handler: app.routes()}
+}
+
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// request sends body, which is either a raw string or a value to encode as
+// JSON, with the token as a Bearer token unless it is empty.
+func (ts *testServer) request(t *testing.T, method, path, token string, body interface{}) testResponse {
+	t.Helper()
+
+	header := make(http.Header)
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return ts.requestWithHeader(t, method, path, header, body)
+}
+
+func (ts *testServer) requestWithHeader(t *testing.T, method, path string, header http.Header, body interface{}) testResponse {
+	t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	default:
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(js)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+
+	return testResponse{status: rec.Code, header: rec.Header(), body: rec.Body.Bytes()}
+}
+
+func (res testResponse) decode(t *testing.T, dst interface{}) {
+	t.Helper()
+
+	err := json.Unmarshal(res.body, dst)
+	if err != nil {
+		t.Fatalf("decoding response %q: %v", res.body, err)
+	}
+}
+
+// errorField returns the message for key from a validation error response.
+func (res testResponse) errorField(t *testing.T, key string) string {
+	t.Helper()
+
+	var body struct {
+		Error map[string]string `json:"error"`
+	}
+	res.decode(t, &body)
+
+	return body.Error[key]
+}
+
+func (res testResponse) errorMessage(t *testing.T) string {
+	t.Helper()
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	res.decode(t, &body)
+
+	return body.Error
+}
+
+func assertStatus(t *testing.T, res testResponse, want int) {
+	t.Helper()
+
+	if res.status != want {
+		t.Fatalf("got status %d, want %d; body: %s", res.status, want, res.body)
+	}
+}
+
+// createTestUser inserts a user with testPassword directly through the
+// models.
+func createTestUser(t *testing.T, app *application, email string, activated bool, permissions ...string) *data.User {
+	t.Helper()
+
+	user := &data.User{Name: "Test User", Email: email, Activated: activated}
+
+	err := user.Password.Set(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(permissions) > 0 {
+		err = app.models.Permissions.AddForUser(context.Background(), user.ID, permissions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return user
+}
+
+// authToken returns a fresh authentication token for the user.
+func authToken(t *testing.T, app *application, user *data.User) string {
+	t.Helper()
+
+	token, err := app.models.Tokens.New(context.Background(), user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token.Plaintext
+}
+
+// newAuthenticatedUser creates an activated user with the permissions and
+// returns an authentication token for them.
+func newAuthenticatedUser(t *testing.T, app *application, email string, permissions ...string) (*data.User, string) {
+	t.Helper()
+
+	user := createTestUser(t, app, email, true, permissions...)
+	return user, authToken(t, app, user)
+}
+
+func createTestCharacter(t *testing.T, app *application, name string, roles ...string) *data.Character {
+	t.Helper()
+
+	character := &data.Character{
+		Slug:      data.Slugify(name),
+		Name:      name,
+		Health:    600,
+		MoveSpeed: 300,
+		Mana:      300,
+		Roles:     roles,
+	}
+
+	err := app.models.Characters.Insert(context.Background(), character)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return character
+}
+
+func createTestPlayer(t *testing.T, app *application, nickname string, mmr int32, roles ...string) *data.Player {
+	t.Helper()
+
+	player := &data.Player{
+		Nickname:     nickname,
+		MMR:          mmr,
+		WinRate:      50,
+		TotalMatches: 1000,
+		Roles:        roles,
+	}
+
+	err := app.models.Players.Insert(context.Background(), player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return player
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
@@ -30,10 +31,26 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 	
-	user, err := app.models.Users.GetByEmail(input.Email)
+	retryAfter, locked, err := app.checkLoginThrottle(r, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter, locked)
+		return
+	}
+	
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
+				err = app.recordLoginFailure(r, input.Email, nil)
+				if err != nil {
+					app.serverErrorResponse(w, r, err)
+					return
+				}
 				app.invalidCredentialsResponse(w, r)
 			default:
 				app.serverErrorResponse(w, r, err)
@@ -48,22 +65,151 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		err = app.recordLoginFailure(r, input.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	enrollment, err := app.models.MFA.GetTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The failure count is only cleared once tokens are issued, otherwise
+	// knowing the password would be enough to keep resetting it between
+	// guesses at the second factor.
+	if enrollment != nil && enrollment.Confirmed {
+		app.mfaChallengeResponse(w, r, user)
+		return
+	}
+
+	env, err := app.issueAuthenticationTokens(r.Context(), user, "")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.clearLoginFailures(r.Context(), input.Email)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 	
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mfaChallengeResponse answers a login which still needs a second factor with
+// a challenge token to complete it at /v1/tokens/authentication/mfa.
+func (app *application) mfaChallengeResponse(w http.ResponseWriter, r *http.Request, user *data.User) {
+	challenge, err := app.models.Tokens.New(r.Context(), user.ID, app.config.totp.challengeTTL, data.ScopeMFAChallenge)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"mfa_required": true, "mfa_token": challenge}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.invalidRefreshTokenResponse(w, r)
+		return
+	}
+
+	token, err := app.models.Tokens.UseRefresh(r.Context(), input.RefreshToken)
+	if err != nil {
+		switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidRefreshTokenResponse(w, r)
+			case errors.Is(err, data.ErrRefreshTokenReused):
+				app.requestLogger(r).PrintWarn("refresh token reuse detected, token family revoked", map[string]interface{}{
+					"user_id": token.UserID,
+				})
+				app.invalidRefreshTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(r.Context(), token.UserID)
+	if err != nil {
+		switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidRefreshTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env, err := app.issueAuthenticationTokens(r.Context(), user, token.Family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// issueAuthenticationTokens creates a new access/refresh token pair for the
+// user. Passing an empty family starts a new one. In JWT mode the access
+// token is a signed JWT, while the refresh token stays in the database so it
+// can be rotated and revoked.
+func (app *application) issueAuthenticationTokens(ctx context.Context, user *data.User, family string) (envelope, error) {
+	if app.config.auth.mode != authModeJWT {
+		access, refresh, err := app.models.Tokens.NewPair(ctx, user.ID, app.config.auth.accessTokenTTL, app.config.auth.refreshTokenTTL, family)
+		if err != nil {
+			return nil, err
+		}
+
+		return envelope{"authentication_token": access, "refresh_token": refresh}, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := app.models.Tokens.NewForFamily(ctx, user.ID, app.config.auth.refreshTokenTTL, data.ScopeRefresh, family)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := app.newJWTAccessToken(user, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{"authentication_token": access, "refresh_token": refresh}, nil
+}
+
 func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
@@ -84,7 +230,7 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 	}
 	
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -102,7 +248,7 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 45*time.Minute, data.ScopePasswordReset)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -113,9 +259,9 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 			"passwordResetToken": token.Plaintext,
 		}
 
-		err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+		err := app.sendMail(r.Context(), user.Email, "token_password_reset.tmpl", data)
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			app.requestLogger(r).PrintError(err, nil)
 		}
 	})
 
@@ -147,7 +293,7 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -165,7 +311,7 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -176,9 +322,9 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 			"activationToken": token.Plaintext,
 		}
 
-		err = app.mailer.Send(user.Email, "token_activation.tmpl", data)
+		err := app.sendMail(r.Context(), user.Email, "token_activation.tmpl", data)
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			app.requestLogger(r).PrintError(err, nil)
 		}
 	})
 
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"goproject/pkg/data"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tokenPair struct {
+	Access  data.Token `json:"authentication_token"`
+	Refresh data.Token `json:"refresh_token"`
+}
+
+func TestCreateAuthenticationToken(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "alice@example.com", true, "characters:read")
+
+	tests := []struct {
+		name string
+		body interface{}
+		want int
+	}{
+		{"valid", map[string]string{"email": "alice@example.com", "password": testPassword}, http.StatusCreated},
+		{"wrong password", map[string]string{"email": "alice@example.com", "password": "wrongpassword"}, http.StatusUnauthorized},
+		{"unknown email", map[string]string{"email": "nobody@example.com", "password": testPassword}, http.StatusUnauthorized},
+		{"invalid email", map[string]string{"email": "alice", "password": testPassword}, http.StatusUnprocessableEntity},
+		{"missing password", map[string]string{"email": "alice@example.com"}, http.StatusUnprocessableEntity},
+		{"bad body", `{"email": "alice@example.com",}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", tt.body)
+			assertStatus(t, res, tt.want)
+
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			var tokens tokenPair
+			res.decode(t, &tokens)
+
+			if len(tokens.Access.Plaintext) != 26 || len(tokens.Refresh.Plaintext) != 26 {
+				t.Fatalf("got tokens %+v", tokens)
+			}
+
+			res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Access.Plaintext, nil)
+			assertStatus(t, res, http.StatusOK)
+
+			// Refresh tokens can't be used to authenticate.
+			res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Refresh.Plaintext, nil)
+			assertStatus(t, res, http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	app, mailer := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "alice@example.com", true)
+
+	wrong := map[string]string{"email": "alice@example.com", "password": "wrongpassword"}
+	right := map[string]string{"email": "alice@example.com", "password": testPassword}
+
+	for i := 0; i < app.config.login.maxFailures; i++ {
+		res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", wrong)
+		assertStatus(t, res, http.StatusUnauthorized)
+	}
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", right)
+	assertStatus(t, res, http.StatusTooManyRequests)
+
+	if got, want := res.errorMessage(t), "this account is temporarily locked due to too many failed login attempts"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+	if res.header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	app.wg.Wait()
+
+	messages := mailer.messages()
+	if len(messages) != 1 || messages[0].template != "account_unlock.tmpl" {
+		t.Fatalf("got mail %+v, want one unlock email", messages)
+	}
+	token := messages[0].data["unlockToken"].(string)
+
+	res = ts.request(t, http.MethodPut, "/v1/users/unlocked", "", map[string]string{"token": strings.Repeat("A", 26)})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPut, "/v1/users/unlocked", "", map[string]string{"token": token})
+	assertStatus(t, res, http.StatusOK)
+
+	res = ts.request(t, http.MethodPut, "/v1/users/unlocked", "", map[string]string{"token": token})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", right)
+	assertStatus(t, res, http.StatusCreated)
+}
+
+func TestLoginBackoff(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.login.backoffBase = time.Minute
+	app.config.login.backoffMax = time.Hour
+
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "alice@example.com", true)
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": "wrongpassword"})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusTooManyRequests)
+
+	if got, want := res.errorMessage(t), "too many failed login attempts, please try again later"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+	if got := res.header.Get("Retry-After"); got != "60" {
+		t.Errorf("got Retry-After %q, want 60", got)
+	}
+}
+
+func TestRefreshAuthenticationToken(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "alice@example.com", true, "characters:read")
+
+	res := ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusCreated)
+
+	var first tokenPair
+	res.decode(t, &first)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": first.Refresh.Plaintext})
+	assertStatus(t, res, http.StatusCreated)
+
+	var second tokenPair
+	res.decode(t, &second)
+
+	if second.Refresh.Plaintext == first.Refresh.Plaintext {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	res = ts.request(t, http.MethodGet, "/v1/characters", second.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusOK)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "abc"},
+		{"unknown", strings.Repeat("A", 26)},
+		{"access token", second.Access.Plaintext},
+		// Reusing a rotated token revokes the whole family, including the
+		// token it was rotated into.
+		{"reused", first.Refresh.Plaintext},
+		{"revoked family", second.Refresh.Plaintext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": tt.token})
+			assertStatus(t, res, http.StatusUnauthorized)
+
+			if got, want := res.errorMessage(t), "invalid or expired refresh token"; got != want {
+				t.Errorf("got error %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCreateActivationToken(t *testing.T) {
+	app, mailer := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "active@example.com", true)
+	createTestUser(t, app, "inactive@example.com", false)
+
+	tests := []struct {
+		name      string
+		email     string
+		want      int
+		wantError string
+	}{
+		{"inactive user", "inactive@example.com", http.StatusAccepted, ""},
+		{"active user", "active@example.com", http.StatusUnprocessableEntity, "user has already been activated"},
+		{"unknown email", "nobody@example.com", http.StatusUnprocessableEntity, "no matching email address found"},
+		{"missing email", "", http.StatusUnprocessableEntity, "must be provided"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/tokens/activation", "", map[string]string{"email": tt.email})
+			assertStatus(t, res, tt.want)
+
+			if tt.wantError != "" {
+				if got := res.errorField(t, "email"); got != tt.wantError {
+					t.Errorf("got email error %q, want %q", got, tt.wantError)
+				}
+			}
+		})
+	}
+
+	app.wg.Wait()
+
+	messages := mailer.messages()
+	if len(messages) != 1 || messages[0].recipient != "inactive@example.com" || messages[0].template != "token_activation.tmpl" {
+		t.Fatalf("got mail %+v, want one activation email", messages)
+	}
+
+	res := ts.request(t, http.MethodPut, "/v1/users/activated", "", map[string]string{"token": messages[0].data["activationToken"].(string)})
+	assertStatus(t, res, http.StatusOK)
+}
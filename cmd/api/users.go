@@ -27,58 +27,62 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Activated: false,
 	}
 
+	v := validator.New()
+
+	// bcrypt refuses passwords over 72 bytes, so check the password before
+	// hashing it.
+	if data.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = user.Password.Set(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	
-	v := validator.New()
 
 	if data.ValidateUser(v, user); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	var token *data.Token
+
+	err = app.models.WithTx(r.Context(), func(tx data.Models) error {
+		err := tx.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Permissions.AddForUser(r.Context(), user.ID, data.DefaultPermissions...)
+		if err != nil {
+			return err
+		}
+
+		token, err = tx.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
+		return err
+	})
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrDuplicateEmail):
 				v.AddError("email", "a user with this email address already exists")
 				app.failedValidationResponse(w, r, v.Errors)
 			default:
-				app.serverErrorResponse(w, r, err)
+				app.databaseErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "characters:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	err = app.models.Permissions.AddForUser(user.ID, "players:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	app.background(func() {
 	data := map[string]interface{}{
 		"activationToken": token.Plaintext,
 		"userID": user.ID,
 	}
 	
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		err := app.sendMail(r.Context(), user.Email, "user_welcome.tmpl", data)
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			app.requestLogger(r).PrintError(err, nil)
 		}
 	})
 
@@ -104,33 +108,35 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	var user *data.User
+
+	err = app.models.WithTx(r.Context(), func(tx data.Models) error {
+		var err error
+		user, err = tx.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
+		if err != nil {
+			return err
+		}
+
+		user.Activated = true
+		err = tx.Users.Update(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		return tx.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
+	})
 	if err != nil {
 		switch {
 			case errors.Is(err, data.ErrRecordNotFound):
 				v.AddError("token", "invalid or expired activation token")
 				app.failedValidationResponse(w, r, v.Errors)
-			default:
-				app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	user.Activated = true
-	err = app.models.Users.Update(user)
-	if err != nil {
-		switch {
 			case errors.Is(err, data.ErrEditConflict):
 				app.editConflictResponse(w, r)
 			default:
-				app.serverErrorResponse(w, r, err)
+				app.databaseErrorResponse(w, r, err)
 		}
 		return
 	}
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -160,41 +166,43 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 	
-	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired password reset token")
-			app.failedValidationResponse(w, r, v.Errors)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
+	// Hash the new password up front, so it isn't redone if the transaction
+	// has to be retried.
+	var hashed data.User
 
-	err = user.Password.Set(input.Password)
+	err = hashed.Password.Set(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.models.Users.Update(user)
+	err = app.models.WithTx(r.Context(), func(tx data.Models) error {
+		user, err := tx.Users.GetForToken(r.Context(), data.ScopePasswordReset, input.TokenPlaintext)
+		if err != nil {
+			return err
+		}
+
+		user.Password = hashed.Password
+		err = tx.Users.Update(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		return tx.Tokens.DeleteAllForUser(r.Context(), data.ScopePasswordReset, user.ID)
+	})
 	if err != nil {
 		switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("token", "invalid or expired password reset token")
+				app.failedValidationResponse(w, r, v.Errors)
 			case errors.Is(err, data.ErrEditConflict):
 				app.editConflictResponse(w, r)
 			default:
-				app.serverErrorResponse(w, r, err)
+				app.databaseErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	env := envelope{"message": "your password was successfully reset"}
 	
 	err = app.writeJSON(w, http.StatusOK, env, nil)
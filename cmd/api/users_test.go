@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegisterUser(t *testing.T) {
+	app, mailer := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "taken@example.com", true)
+
+	tests := []struct {
+		name      string
+		body      interface{}
+		want      int
+		wantField string
+		wantError string
+	}{
+		{"valid", map[string]string{"name": "Alice", "email": "alice@example.com", "password": testPassword}, http.StatusAccepted, "", ""},
+		{"duplicate email", map[string]string{"name": "Alice", "email": "taken@example.com", "password": testPassword}, http.StatusUnprocessableEntity, "email", "a user with this email address already exists"},
+		{"missing name", map[string]string{"email": "bob@example.com", "password": testPassword}, http.StatusUnprocessableEntity, "name", "must be provided"},
+		{"invalid email", map[string]string{"name": "Bob", "email": "bob", "password": testPassword}, http.StatusUnprocessableEntity, "email", "must be a valid email address"},
+		{"short password", map[string]string{"name": "Bob", "email": "bob@example.com", "password": "short"}, http.StatusUnprocessableEntity, "password", "must be at least 8 bytes long"},
+		{"long password", map[string]string{"name": "Bob", "email": "bob@example.com", "password": strings.Repeat("a", 73)}, http.StatusUnprocessableEntity, "password", "must not be more than 72 bytes long"},
+		{"unknown field", map[string]string{"name": "Bob", "email": "bob@example.com", "password": testPassword, "role": "admin"}, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/users", "", tt.body)
+			assertStatus(t, res, tt.want)
+
+			if tt.wantField != "" {
+				if got := res.errorField(t, tt.wantField); got != tt.wantError {
+					t.Errorf("got %s error %q, want %q", tt.wantField, got, tt.wantError)
+				}
+			}
+		})
+	}
+
+	app.wg.Wait()
+
+	messages := mailer.messages()
+	if len(messages) != 1 || messages[0].recipient != "alice@example.com" || messages[0].template != "user_welcome.tmpl" {
+		t.Fatalf("got mail %+v, want one welcome email to alice", messages)
+	}
+
+	user, err := app.models.Users.GetByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Activated {
+		t.Error("new user is already activated")
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(permissions, data.DefaultPermissions) {
+		t.Errorf("got permissions %v, want %v", permissions, data.DefaultPermissions)
+	}
+}
+
+func TestActivateUser(t *testing.T) {
+	app, mailer := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.request(t, http.MethodPost, "/v1/users", "", map[string]string{"name": "Alice", "email": "alice@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusAccepted)
+
+	app.wg.Wait()
+	token := mailer.messages()[0].data["activationToken"].(string)
+
+	tests := []struct {
+		name      string
+		token     string
+		want      int
+		wantError string
+	}{
+		{"malformed token", "abc", http.StatusUnprocessableEntity, "must be 26 bytes long"},
+		{"unknown token", strings.Repeat("A", 26), http.StatusUnprocessableEntity, "invalid or expired activation token"},
+		{"valid token", token, http.StatusOK, ""},
+		{"used token", token, http.StatusUnprocessableEntity, "invalid or expired activation token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPut, "/v1/users/activated", "", map[string]string{"token": tt.token})
+			assertStatus(t, res, tt.want)
+
+			if tt.wantError != "" {
+				if got := res.errorField(t, "token"); got != tt.wantError {
+					t.Errorf("got token error %q, want %q", got, tt.wantError)
+				}
+				return
+			}
+
+			var body struct {
+				User data.User `json:"user"`
+			}
+			res.decode(t, &body)
+
+			if !body.User.Activated || body.User.Email != "alice@example.com" {
+				t.Errorf("got user %+v", body.User)
+			}
+		})
+	}
+
+	// Activation unlocks the default permissions.
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusCreated)
+
+	var tokens struct {
+		Access data.Token `json:"authentication_token"`
+	}
+	res.decode(t, &tokens)
+
+	res = ts.request(t, http.MethodGet, "/v1/characters", tokens.Access.Plaintext, nil)
+	assertStatus(t, res, http.StatusOK)
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	app, mailer := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	createTestUser(t, app, "alice@example.com", true)
+	createTestUser(t, app, "inactive@example.com", false)
+
+	tests := []struct {
+		name      string
+		email     string
+		want      int
+		wantError string
+	}{
+		{"unknown email", "nobody@example.com", http.StatusUnprocessableEntity, "no matching email address found"},
+		{"inactive user", "inactive@example.com", http.StatusUnprocessableEntity, "user account must be activated"},
+		{"invalid email", "alice", http.StatusUnprocessableEntity, "must be a valid email address"},
+		{"valid", "alice@example.com", http.StatusAccepted, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/tokens/password-reset", "", map[string]string{"email": tt.email})
+			assertStatus(t, res, tt.want)
+
+			if tt.wantError != "" {
+				if got := res.errorField(t, "email"); got != tt.wantError {
+					t.Errorf("got email error %q, want %q", got, tt.wantError)
+				}
+			}
+		})
+	}
+
+	app.wg.Wait()
+
+	messages := mailer.messages()
+	if len(messages) != 1 || messages[0].template != "token_password_reset.tmpl" {
+		t.Fatalf("got mail %+v, want one password reset email", messages)
+	}
+	token := messages[0].data["passwordResetToken"].(string)
+
+	res := ts.request(t, http.MethodPut, "/v1/users/password", "", map[string]string{"token": token, "password": "short"})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPut, "/v1/users/password", "", map[string]string{"token": strings.Repeat("A", 26), "password": "n3wpassword!"})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPut, "/v1/users/password", "", map[string]string{"token": token, "password": "n3wpassword!"})
+	assertStatus(t, res, http.StatusOK)
+
+	res = ts.request(t, http.MethodPut, "/v1/users/password", "", map[string]string{"token": token, "password": "an0therpassword"})
+	assertStatus(t, res, http.StatusUnprocessableEntity)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": testPassword})
+	assertStatus(t, res, http.StatusUnauthorized)
+
+	res = ts.request(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{"email": "alice@example.com", "password": "n3wpassword!"})
+	assertStatus(t, res, http.StatusCreated)
+}
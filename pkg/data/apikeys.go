@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"goproject/pkg/validator"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix makes keys easy to recognise in logs and secret scanners.
+const APIKeyPrefix = "dk_"
+
+var (
+	ErrDuplicateAPIKeyName = errors.New("duplicate api key name")
+)
+
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	UserID      int64       `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      *time.Time  `json:"expiry,omitempty"`
+	LastUsedAt  *time.Time  `json:"last_used_at,omitempty"`
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(strings.HasPrefix(keyPlaintext, APIKeyPrefix), "key", "must be a valid api key")
+	v.Check(len(keyPlaintext) == len(APIKeyPrefix)+26, "key", "must be a valid api key")
+}
+
+type APIKeyModel struct {
+	DB Querier
+	Timeout time.Duration
+}
+
+// New generates a key for the user and stores its hash. The plaintext is only
+// available on the returned value.
+func (m APIKeyModel) New(ctx context.Context, userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	token, err := generateToken(userID, 0, ScopeAPIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &APIKey{
+		Name:        name,
+		Plaintext:   APIKeyPrefix + token.Plaintext,
+		UserID:      userID,
+		Permissions: permissions,
+		Expiry:      expiry,
+	}
+
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	err = m.Insert(ctx, key)
+	return key, err
+}
+
+func (m APIKeyModel) Insert(ctx context.Context, key *APIKey) error {
+	query := `
+	INSERT INTO api_keys (hash, user_id, name, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	args := []interface{}{key.Hash, key.UserID, key.Name, pq.Array(key.Permissions), key.Expiry}
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "APIKeyModel.Insert")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+func (m APIKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+	SELECT id, created_at, name, user_id, permissions, expiry, last_used_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY id`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "APIKeyModel.GetAllForUser")
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.Name,
+			&key.UserID,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForKey looks up an unexpired key together with its owner and records
+// that the key has just been used.
+func (m APIKeyModel) GetForKey(ctx context.Context, keyPlaintext string) (*APIKey, *User, error) {
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+	UPDATE api_keys
+	SET last_used_at = $2
+	FROM users
+	WHERE api_keys.hash = $1
+	AND users.id = api_keys.user_id
+	AND (api_keys.expiry IS NULL OR api_keys.expiry > $2)
+	RETURNING api_keys.id, api_keys.created_at, api_keys.name, api_keys.user_id, api_keys.permissions, api_keys.expiry, api_keys.last_used_at,
+	users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version`
+
+	var (
+		key  APIKey
+		user User
+	)
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "APIKeyModel.GetForKey")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:], time.Now()).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.Name,
+		&key.UserID,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return &key, &user, nil
+}
+
+func (m APIKeyModel) Delete(ctx context.Context, id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM api_keys
+	WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "APIKeyModel.Delete")
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
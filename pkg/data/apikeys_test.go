@@ -0,0 +1,83 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+		bob := insertTestUser(t, models, "bob@example.com")
+
+		expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		reports, err := models.APIKeys.New(ctx, alice.ID, "reports", data.Permissions{"characters:read", "players:read"}, &expiry)
+		assertErrorIs(t, err, nil)
+		if reports.ID < 1 || reports.CreatedAt.IsZero() || !strings.HasPrefix(reports.Plaintext, data.APIKeyPrefix) {
+			t.Fatalf("got key %+v, want an id, creation time and plaintext", reports)
+		}
+
+		_, err = models.APIKeys.New(ctx, alice.ID, "reports", data.Permissions{"characters:read"}, nil)
+		assertErrorIs(t, err, data.ErrDuplicateAPIKeyName)
+
+		// Names only have to be unique for each user.
+		_, err = models.APIKeys.New(ctx, bob.ID, "reports", data.Permissions{"characters:read"}, nil)
+		assertErrorIs(t, err, nil)
+
+		past := time.Now().Add(-time.Hour)
+		expired, err := models.APIKeys.New(ctx, alice.ID, "expired", data.Permissions{"characters:read"}, &past)
+		assertErrorIs(t, err, nil)
+
+		keys, err := models.APIKeys.GetAllForUser(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if len(keys) != 2 || keys[0].ID != reports.ID || keys[1].ID != expired.ID {
+			t.Fatalf("got keys %+v, want reports then expired", keys)
+		}
+		if keys[0].Plaintext != "" || keys[0].LastUsedAt != nil || keys[0].Expiry == nil || !keys[0].Expiry.Equal(expiry) || !slices.Equal(keys[0].Permissions, reports.Permissions) {
+			t.Fatalf("got key %+v, want %+v without its plaintext", keys[0], reports)
+		}
+
+		key, user, err := models.APIKeys.GetForKey(ctx, reports.Plaintext)
+		assertErrorIs(t, err, nil)
+		if key.ID != reports.ID || user.ID != alice.ID || key.LastUsedAt == nil {
+			t.Fatalf("got key %+v for user %d, want %d used by %d", key, user.ID, reports.ID, alice.ID)
+		}
+
+		keys, err = models.APIKeys.GetAllForUser(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if keys[0].LastUsedAt == nil {
+			t.Fatal("last use wasn't recorded")
+		}
+
+		_, _, err = models.APIKeys.GetForKey(ctx, expired.Plaintext)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+		_, _, err = models.APIKeys.GetForKey(ctx, data.APIKeyPrefix+"ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		// Keys can only be deleted by their owner.
+		err = models.APIKeys.Delete(ctx, reports.ID, bob.ID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.APIKeys.Delete(ctx, reports.ID, alice.ID)
+		assertErrorIs(t, err, nil)
+
+		err = models.APIKeys.Delete(ctx, reports.ID, alice.ID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		_, _, err = models.APIKeys.GetForKey(ctx, reports.Plaintext)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		keys, err = models.APIKeys.GetAllForUser(ctx, bob.ID)
+		assertErrorIs(t, err, nil)
+		if len(keys) != 1 {
+			t.Fatalf("got %d keys for bob, want 1", len(keys))
+		}
+	})
+}
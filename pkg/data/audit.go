@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditLoginLockout     = "login.lockout"
+	AuditLoginIPLockout   = "login.ip_lockout"
+	AuditAccountUnlock    = "account.unlock"
+	AuditPermissionGrant  = "permission.grant"
+	AuditPermissionRevoke = "permission.revoke"
+)
+
+// AuditEvent is a security relevant event, kept for later review.
+type AuditEvent struct {
+	ID        int64             `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Event     string            `json:"event"`
+	UserID    *int64            `json:"user_id,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+type AuditModel struct {
+	DB Querier
+	Timeout time.Duration
+}
+
+func (m AuditModel) Insert(ctx context.Context, event *AuditEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+	if event.Details == nil {
+		details = []byte("{}")
+	}
+
+	query := `
+	INSERT INTO audit_events (event, user_id, ip, details)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	args := []interface{}{event.Event, event.UserID, event.IP, details}
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "AuditModel.Insert")
+	defer span.End()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+	return translateError(err)
+}
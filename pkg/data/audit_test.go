@@ -0,0 +1,32 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"testing"
+)
+
+func TestAuditInsert(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+
+		events := []*data.AuditEvent{
+			{Event: data.AuditLoginLockout, UserID: &alice.ID, IP: "192.0.2.1", Details: map[string]string{"failures": "5"}},
+			{Event: data.AuditLoginIPLockout, IP: "192.0.2.1"},
+			{Event: data.AuditPermissionGrant, UserID: &alice.ID, Details: map[string]string{}},
+		}
+
+		var lastID int64
+		for _, event := range events {
+			err := models.Audit.Insert(ctx, event)
+			assertErrorIs(t, err, nil)
+
+			if event.ID <= lastID || event.CreatedAt.IsZero() {
+				t.Fatalf("got event %+v, want an increasing id and a creation time", event)
+			}
+			lastID = event.ID
+		}
+	})
+}
@@ -5,14 +5,24 @@ import (
 	"context" 
 	"database/sql"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 	"goproject/pkg/validator"
 	"github.com/lib/pq"
 )
 
+var (
+	ErrDuplicateSlug = errors.New("duplicate slug")
+
+	SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
 type Character struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
+	Slug      string    `json:"slug"`
 	Name      string    `json:"names"`
 	Health    int32     `json:"health"`
 	MoveSpeed int32     `json:"movespeed"`
@@ -30,46 +40,90 @@ func ValidateCharacter(v *validator.Validator, character *Character) {
 	v.Check(character.Roles != nil, "Roles", "must be provided")
 	v.Check(len(character.Roles) >= 1, "Roles", "must contain at least 1 genre")
 	v.Check(validator.Unique(character.Roles), "Roles", "must not contain duplicate values")
+	v.Check(character.Slug != "", "slug", "must be provided")
+	v.Check(len(character.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(character.Slug, SlugRX), "slug", "must contain only lowercase letters, digits and single dashes")
 }
 
-type MockCharacterModel struct {
-	DB *sql.DB
+// Slugify derives a character's slug from its name, e.g. "Nature's Prophet"
+// becomes "natures-prophet". The slug migration backfills existing rows the
+// same way.
+func Slugify(name string) string {
+	slug := strings.ReplaceAll(strings.ToLower(name), "'", "")
+	slug = slugSeparatorRX.ReplaceAllString(slug, "-")
+	return strings.Trim(slug, "-")
+}
+
+type CharacterModel struct {
+	DB Querier
+	Timeout time.Duration
 }
 
 
-func (c MockCharacterModel) Insert(character *Character) error {
+func (c CharacterModel) Insert(ctx context.Context, character *Character) error {
 	query := `
-			INSERT INTO characters (names,health,movespeed,mana,roles)
-			VALUES ($1, $2, $3, $4, $5)
+			INSERT INTO characters (slug,names,health,movespeed,mana,roles)
+			VALUES ($1, $2, $3, $4, $5, $6)
 			RETURNING id, created_at`
 
-	args := []interface{}{character.Name, character.Health, character.MoveSpeed, character.Mana, pq.Array(character.Roles)}
+	args := []interface{}{character.Slug, character.Name, character.Health, character.MoveSpeed, character.Mana, pq.Array(character.Roles)}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
 	defer cancel()
-	return c.DB.QueryRowContext(ctx,query, args...).Scan(&character.ID, &character.CreatedAt)
+	ctx, span := startSpan(ctx, "CharacterModel.Insert")
+	defer span.End()
+	err := c.DB.QueryRowContext(ctx,query, args...).Scan(&character.ID, &character.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
 }
 
+// Upsert creates the character with the given slug, or replaces it if it
+// already exists, reporting which happened.
+func (c CharacterModel) Upsert(ctx context.Context, character *Character) (bool, error) {
+	query := `
+	INSERT INTO characters (slug, names, health, movespeed, mana, roles)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (slug) DO UPDATE
+	SET names = EXCLUDED.names, health = EXCLUDED.health, movespeed = EXCLUDED.movespeed, mana = EXCLUDED.mana, roles = EXCLUDED.roles
+	RETURNING id, created_at, (xmax = 0) AS created`
 
-func (c MockCharacterModel) Get(id int64) (*Character, error) {
+	args := []interface{}{character.Slug, character.Name, character.Health, character.MoveSpeed, character.Mana, pq.Array(character.Roles)}
+
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "CharacterModel.Upsert")
+	defer span.End()
+
+	var created bool
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&character.ID, &character.CreatedAt, &created)
+	return created, translateError(err)
+}
+
+
+func (c CharacterModel) Get(ctx context.Context, id int64) (*Character, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-	SELECT id, created_at, names,health,movespeed,mana,roles
+	SELECT id, created_at, slug, names,health,movespeed,mana,roles
 	FROM characters
 	WHERE id = $1`
 
 	var character Character
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
 
 	defer cancel()
+	ctx, span := startSpan(ctx, "CharacterModel.Get")
+	defer span.End()
 
 	err := c.DB.QueryRowContext(ctx,query, id).Scan(
 		&character.ID,
 		&character.CreatedAt,
+		&character.Slug,
 		&character.Name,
 		&character.Health,
 		&character.MoveSpeed,
@@ -89,12 +143,49 @@ func (c MockCharacterModel) Get(id int64) (*Character, error) {
 
 }
 
-func (c MockCharacterModel) Update(character *Character) error {
+// GetBySlug finds a character by slug. The column is citext, so the match
+// ignores case.
+func (c CharacterModel) GetBySlug(ctx context.Context, slug string) (*Character, error) {
+	query := `
+	SELECT id, created_at, slug, names,health,movespeed,mana,roles
+	FROM characters
+	WHERE slug = $1`
+
+	var character Character
+
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "CharacterModel.GetBySlug")
+	defer span.End()
+
+	err := c.DB.QueryRowContext(ctx, query, strings.ToLower(slug)).Scan(
+		&character.ID,
+		&character.CreatedAt,
+		&character.Slug,
+		&character.Name,
+		&character.Health,
+		&character.MoveSpeed,
+		&character.Mana,
+		pq.Array(&character.Roles),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &character, nil
+}
+
+func (c CharacterModel) Update(ctx context.Context, character *Character) error {
 	query := `
 	UPDATE characters
-	SET names = $1, health = $2, movespeed = $3, mana = $4,roles=$5
+	SET names = $1, health = $2, movespeed = $3, mana = $4,roles=$5, slug = $7
 	WHERE id = $6
-	RETURNING id, created_at, names, health, movespeed, mana, roles`
+	RETURNING id, created_at, slug, names, health, movespeed, mana, roles`
 	args := []interface{}{
 		character.Name,
 		character.Health,
@@ -102,14 +193,18 @@ func (c MockCharacterModel) Update(character *Character) error {
 		character.Mana,
 		pq.Array(character.Roles),
 		character.ID,
+		character.Slug,
 	}	
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "CharacterModel.Update")
+	defer span.End()
 
 	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
 		&character.ID,
 		&character.CreatedAt,
+		&character.Slug,
 		&character.Name,
 		&character.Health,
 		&character.MoveSpeed,
@@ -122,14 +217,14 @@ func (c MockCharacterModel) Update(character *Character) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return translateError(err)
 		}
 	}
 
 	return nil 
 }
 
-func (c MockCharacterModel) Delete(id int64) error {
+func (c CharacterModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
@@ -138,8 +233,10 @@ func (c MockCharacterModel) Delete(id int64) error {
 	DELETE FROM characters
 	WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "CharacterModel.Delete")
+	defer span.End()
 
 	result, err := c.DB.ExecContext(ctx,query, id)
 	if err != nil {
@@ -157,16 +254,18 @@ func (c MockCharacterModel) Delete(id int64) error {
 	return nil
 }
 
-func (c MockCharacterModel) GetAll(Name string, Roles []string, filters Filters) ([]*Character,Metadata, error) {
+func (c CharacterModel) GetAll(ctx context.Context, Name string, Roles []string, filters Filters) ([]*Character,Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(),id, created_at, names, health, movespeed, mana,roles
+		SELECT count(*) OVER(),id, created_at, slug, names, health, movespeed, mana,roles
 		FROM characters
 		WHERE (to_tsvector('simple', names) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (roles @> $2 OR $2 = '{}')
 		ORDER BY %s %s, id ASC LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, c.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "CharacterModel.GetAll")
+	defer span.End()
 
 	args := []interface{}{Name, pq.Array(Roles), filters.limit(), filters.offset()}
 
@@ -188,6 +287,7 @@ func (c MockCharacterModel) GetAll(Name string, Roles []string, filters Filters)
 			&totalRecords,
 			&character.ID,
 			&character.CreatedAt,
+			&character.Slug,
 			&character.Name,
 			&character.Health,
 			&character.MoveSpeed,
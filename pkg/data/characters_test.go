@@ -0,0 +1,245 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"slices"
+	"testing"
+)
+
+var characterSortSafelist = []string{"id", "names", "health", "movespeed", "mana", "-id", "-names", "-health", "-movespeed", "-mana"}
+
+func insertTestCharacter(t *testing.T, models data.Models, name string, health, mana int32, roles ...string) *data.Character {
+	t.Helper()
+
+	character := &data.Character{Slug: data.Slugify(name), Name: name, Health: health, MoveSpeed: 300, Mana: mana, Roles: roles}
+
+	err := models.Characters.Insert(context.Background(), character)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return character
+}
+
+func TestCharacterCRUD(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		axe := insertTestCharacter(t, models, "Axe", 700, 250, "Initiator", "Durable")
+		if axe.ID < 1 || axe.CreatedAt.IsZero() {
+			t.Fatalf("got character %+v, want an id and creation time", axe)
+		}
+
+		err := models.Characters.Insert(ctx, &data.Character{Slug: "axe", Name: "Axe Again", Health: 1, MoveSpeed: 1, Roles: []string{"Carry"}})
+		assertErrorIs(t, err, data.ErrDuplicateSlug)
+		assertConstraint(t, err, data.ConstraintUnique, "characters_slug_key")
+
+		got, err := models.Characters.Get(ctx, axe.ID)
+		assertErrorIs(t, err, nil)
+		if got.Slug != "axe" || got.Name != "Axe" || got.Health != 700 || got.MoveSpeed != 300 || got.Mana != 250 || !slices.Equal(got.Roles, axe.Roles) {
+			t.Fatalf("got character %+v, want %+v", got, axe)
+		}
+
+		got, err = models.Characters.GetBySlug(ctx, "AXE")
+		assertErrorIs(t, err, nil)
+		if got.ID != axe.ID {
+			t.Fatalf("got character %d by slug, want %d", got.ID, axe.ID)
+		}
+
+		for _, id := range []int64{0, -1, axe.ID + 100} {
+			_, err = models.Characters.Get(ctx, id)
+			assertErrorIs(t, err, data.ErrRecordNotFound)
+		}
+		_, err = models.Characters.GetBySlug(ctx, "bane")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		got.Name = "Mogul Khan"
+		got.Slug = "mogul-khan"
+		got.Health = 720
+		got.Roles = []string{"Initiator"}
+		err = models.Characters.Update(ctx, got)
+		assertErrorIs(t, err, nil)
+
+		got, err = models.Characters.GetBySlug(ctx, "mogul-khan")
+		assertErrorIs(t, err, nil)
+		if got.Name != "Mogul Khan" || got.Health != 720 || !slices.Equal(got.Roles, []string{"Initiator"}) || !got.CreatedAt.Equal(axe.CreatedAt) {
+			t.Fatalf("got updated character %+v", got)
+		}
+
+		bane := insertTestCharacter(t, models, "Bane", 600, 300, "Disabler")
+
+		bane.Slug = "mogul-khan"
+		err = models.Characters.Update(ctx, bane)
+		assertErrorIs(t, err, data.ErrDuplicateSlug)
+
+		// A character deleted in the meantime is an edit conflict.
+		err = models.Characters.Update(ctx, &data.Character{ID: bane.ID + 100, Slug: "gone", Name: "Gone", Health: 1, MoveSpeed: 1, Roles: []string{"Carry"}})
+		assertErrorIs(t, err, data.ErrEditConflict)
+
+		err = models.Characters.Delete(ctx, axe.ID)
+		assertErrorIs(t, err, nil)
+
+		_, err = models.Characters.Get(ctx, axe.ID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.Characters.Delete(ctx, axe.ID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.Characters.Delete(ctx, 0)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+	})
+}
+
+func TestCharacterUpsert(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		axe := &data.Character{Slug: "axe", Name: "Axe", Health: 700, MoveSpeed: 310, Mana: 250, Roles: []string{"Initiator"}}
+
+		created, err := models.Characters.Upsert(ctx, axe)
+		assertErrorIs(t, err, nil)
+		if !created || axe.ID < 1 {
+			t.Fatalf("got created %t and id %d, want a new character", created, axe.ID)
+		}
+
+		replacement := &data.Character{Slug: "axe", Name: "Axe", Health: 720, MoveSpeed: 310, Mana: 290, Roles: []string{"Initiator", "Durable"}}
+
+		created, err = models.Characters.Upsert(ctx, replacement)
+		assertErrorIs(t, err, nil)
+		if created || replacement.ID != axe.ID || !replacement.CreatedAt.Equal(axe.CreatedAt) {
+			t.Fatalf("got created %t and character %+v, want %d replaced", created, replacement, axe.ID)
+		}
+
+		got, err := models.Characters.Get(ctx, axe.ID)
+		assertErrorIs(t, err, nil)
+		if got.Health != 720 || got.Mana != 290 || !slices.Equal(got.Roles, replacement.Roles) {
+			t.Fatalf("got character %+v after upsert", got)
+		}
+	})
+}
+
+func TestCharacterGetAll(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		insertTestCharacter(t, models, "Axe", 700, 250, "Initiator", "Durable")
+		insertTestCharacter(t, models, "Bane", 600, 300, "Disabler", "Support")
+		insertTestCharacter(t, models, "Crystal Maiden", 560, 400, "Support", "Disabler", "Nuker")
+		insertTestCharacter(t, models, "Dark Seer", 620, 300, "Initiator")
+		insertTestCharacter(t, models, "Earthshaker", 650, 350, "Support", "Initiator")
+
+		tests := []struct {
+			name         string
+			search       string
+			roles        []string
+			filters      data.Filters
+			wantNames    []string
+			wantMetadata data.Metadata
+		}{
+			{
+				name:         "all",
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{"Axe", "Bane", "Crystal Maiden", "Dark Seer", "Earthshaker"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 5},
+			},
+			{
+				name:         "full-text search",
+				search:       "maiden",
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{"Crystal Maiden"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			{
+				name:         "search needs every word",
+				search:       "Dark Maiden",
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{},
+				wantMetadata: data.Metadata{},
+			},
+			{
+				name:         "search matches whole words",
+				search:       "earth",
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{},
+				wantMetadata: data.Metadata{},
+			},
+			{
+				name:         "one role",
+				roles:        []string{"Initiator"},
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{"Axe", "Dark Seer", "Earthshaker"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 3},
+			},
+			{
+				name:         "every role",
+				roles:        []string{"Support", "Disabler"},
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{"Bane", "Crystal Maiden"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+			},
+			{
+				name:         "search and role",
+				search:       "seer",
+				roles:        []string{"Support"},
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "id"},
+				wantNames:    []string{},
+				wantMetadata: data.Metadata{},
+			},
+			{
+				name:         "sort by name descending",
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "-names"},
+				wantNames:    []string{"Earthshaker", "Dark Seer", "Crystal Maiden", "Bane", "Axe"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 5},
+			},
+			{
+				name:         "ties broken by id",
+				filters:      data.Filters{Page: 1, PageSize: 20, Sort: "-mana"},
+				wantNames:    []string{"Crystal Maiden", "Earthshaker", "Bane", "Dark Seer", "Axe"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 5},
+			},
+			{
+				name:         "first page",
+				filters:      data.Filters{Page: 1, PageSize: 2, Sort: "health"},
+				wantNames:    []string{"Crystal Maiden", "Bane"},
+				wantMetadata: data.Metadata{CurrentPage: 1, PageSize: 2, FirstPage: 1, LastPage: 3, TotalRecords: 5},
+			},
+			{
+				name:         "last page",
+				filters:      data.Filters{Page: 3, PageSize: 2, Sort: "health"},
+				wantNames:    []string{"Axe"},
+				wantMetadata: data.Metadata{CurrentPage: 3, PageSize: 2, FirstPage: 1, LastPage: 3, TotalRecords: 5},
+			},
+			{
+				name:         "past the last page",
+				filters:      data.Filters{Page: 4, PageSize: 2, Sort: "health"},
+				wantNames:    []string{},
+				wantMetadata: data.Metadata{},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.filters.SortSafelist = characterSortSafelist
+
+				// The handlers pass an empty list, not nil, for no filter.
+				if tt.roles == nil {
+					tt.roles = []string{}
+				}
+
+				characters, metadata, err := models.Characters.GetAll(context.Background(), tt.search, tt.roles, tt.filters)
+				assertErrorIs(t, err, nil)
+
+				names := []string{}
+				for _, character := range characters {
+					names = append(names, character.Name)
+				}
+
+				if !slices.Equal(names, tt.wantNames) {
+					t.Errorf("got %v, want %v", names, tt.wantNames)
+				}
+				if metadata != tt.wantMetadata {
+					t.Errorf("got metadata %+v, want %+v", metadata, tt.wantMetadata)
+				}
+			})
+		}
+	})
+}
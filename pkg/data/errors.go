@@ -0,0 +1,137 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrSerializationFailure means the transaction clashed with a concurrent one
+// and can safely be retried.
+var ErrSerializationFailure = errors.New("serialization failure")
+
+type ConstraintKind int
+
+const (
+	ConstraintUnique ConstraintKind = iota + 1
+	ConstraintForeignKey
+	ConstraintCheck
+	ConstraintNotNull
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case ConstraintUnique:
+		return "unique"
+	case ConstraintForeignKey:
+		return "foreign key"
+	case ConstraintCheck:
+		return "check"
+	case ConstraintNotNull:
+		return "not null"
+	default:
+		return "unknown"
+	}
+}
+
+// ConstraintError is returned when a write violates a database constraint.
+// Column is empty when PostgreSQL doesn't report one, such as for a check
+// spanning several columns.
+type ConstraintError struct {
+	Kind       ConstraintKind
+	Table      string
+	Constraint string
+	Column     string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s constraint %q violated on %s", e.Kind, e.Constraint, e.Table)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the error a model has declared for the constraint, so callers
+// can keep checking for errors such as ErrDuplicateEmail.
+func (e *ConstraintError) Is(target error) bool {
+	known, ok := constraintErrors[e.Constraint]
+	return ok && known == target
+}
+
+// constraintErrors names the errors callers check for particular
+// constraints.
+var constraintErrors = map[string]error{
+	"users_email_key":           ErrDuplicateEmail,
+	"api_keys_user_id_name_key": ErrDuplicateAPIKeyName,
+	"characters_slug_key":       ErrDuplicateSlug,
+}
+
+// translateError turns PostgreSQL constraint violations and serialization
+// failures into typed errors, and returns any other error unchanged.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	ce := &ConstraintError{
+		Table:      pqErr.Table,
+		Constraint: pqErr.Constraint,
+		Column:     pqErr.Column,
+		Err:        err,
+	}
+
+	switch pqErr.Code {
+	case "23505":
+		ce.Kind = ConstraintUnique
+	case "23503":
+		ce.Kind = ConstraintForeignKey
+	case "23514":
+		ce.Kind = ConstraintCheck
+	case "23502":
+		ce.Kind = ConstraintNotNull
+	case "40001", "40P01":
+		return fmt.Errorf("%w: %w", ErrSerializationFailure, err)
+	default:
+		return err
+	}
+
+	if ce.Column == "" {
+		ce.Column = detailColumn(pqErr.Detail)
+	}
+
+	return ce
+}
+
+// isSerializationFailure reports whether err means the transaction should be
+// retried. Reads don't pass their errors through translateError, so the raw
+// PostgreSQL codes are checked as well.
+func isSerializationFailure(err error) bool {
+	if errors.Is(err, ErrSerializationFailure) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// detailColumn reads the column from a detail such as
+// "Key (email)=(a@example.com) already exists.", which is the only place
+// unique and foreign key violations name it. Multi-column keys are left out.
+func detailColumn(detail string) string {
+	_, rest, ok := strings.Cut(detail, "Key (")
+	if !ok {
+		return ""
+	}
+
+	column, _, ok := strings.Cut(rest, ")=(")
+	if !ok || strings.ContainsAny(column, ", (") {
+		return ""
+	}
+
+	return column
+}
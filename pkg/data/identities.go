@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// IdentityModel links accounts at external identity providers to users.
+type IdentityModel struct {
+	DB Querier
+	Timeout time.Duration
+}
+
+func (m IdentityModel) GetUser(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	FROM users
+	INNER JOIN user_identities ON user_identities.user_id = users.id
+	WHERE user_identities.provider = $1 AND user_identities.subject = $2`
+
+	var user User
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "IdentityModel.GetUser")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m IdentityModel) Insert(ctx context.Context, provider, subject string, userID int64) error {
+	query := `
+	INSERT INTO user_identities (provider, subject, user_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (provider, subject) DO NOTHING`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "IdentityModel.Insert")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, query, provider, subject, userID)
+	return translateError(err)
+}
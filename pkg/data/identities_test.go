@@ -0,0 +1,47 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"testing"
+)
+
+func TestIdentities(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+		bob := insertTestUser(t, models, "bob@example.com")
+
+		_, err := models.Identities.GetUser(ctx, "google", "alice-1")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.Identities.Insert(ctx, "google", "alice-1", alice.ID)
+		assertErrorIs(t, err, nil)
+
+		// An identity stays linked to the first user it was given.
+		err = models.Identities.Insert(ctx, "google", "alice-1", bob.ID)
+		assertErrorIs(t, err, nil)
+
+		// Subjects are only unique for each provider.
+		err = models.Identities.Insert(ctx, "github", "alice-1", bob.ID)
+		assertErrorIs(t, err, nil)
+
+		tests := []struct {
+			provider string
+			subject  string
+			want     int64
+		}{
+			{"google", "alice-1", alice.ID},
+			{"github", "alice-1", bob.ID},
+		}
+
+		for _, tt := range tests {
+			user, err := models.Identities.GetUser(ctx, tt.provider, tt.subject)
+			assertErrorIs(t, err, nil)
+			if user.ID != tt.want || user.Email == "" {
+				t.Fatalf("got user %+v for %s %s, want %d", user, tt.provider, tt.subject, tt.want)
+			}
+		}
+	})
+}
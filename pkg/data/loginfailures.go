@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginFailure tracks consecutive failed logins for a key, such as an account
+// or a client IP address.
+type LoginFailure struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// Locked reports whether the key is locked out at time t.
+func (f *LoginFailure) Locked(t time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(t)
+}
+
+type LoginFailureModel struct {
+	DB Querier
+	Timeout time.Duration
+}
+
+func (m LoginFailureModel) Get(ctx context.Context, key string) (*LoginFailure, error) {
+	query := `
+	SELECT key, failures, last_failure_at, locked_until
+	FROM login_failures
+	WHERE key = $1`
+
+	var failure LoginFailure
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "LoginFailureModel.Get")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &failure, nil
+}
+
+// Record counts a failed login for key. Failures older than window are
+// forgotten, so the count starts again after a quiet period.
+func (m LoginFailureModel) Record(ctx context.Context, key string, window time.Duration) (*LoginFailure, error) {
+	query := `
+	INSERT INTO login_failures (key, failures, last_failure_at)
+	VALUES ($1, 1, $2)
+	ON CONFLICT (key) DO UPDATE
+	SET failures = CASE WHEN login_failures.last_failure_at < $3 THEN 1 ELSE login_failures.failures + 1 END,
+		locked_until = CASE WHEN login_failures.last_failure_at < $3 THEN NULL ELSE login_failures.locked_until END,
+		last_failure_at = $2
+	RETURNING key, failures, last_failure_at, locked_until`
+
+	now := time.Now()
+
+	var failure LoginFailure
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "LoginFailureModel.Record")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, key, now, now.Add(-window)).Scan(
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failure, nil
+}
+
+func (m LoginFailureModel) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `
+	UPDATE login_failures
+	SET locked_until = $2
+	WHERE key = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "LoginFailureModel.Lock")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, query, key, until)
+	return err
+}
+
+// Reset forgets every failure recorded for key, lifting any lockout.
+func (m LoginFailureModel) Reset(ctx context.Context, key string) error {
+	query := `
+	DELETE FROM login_failures
+	WHERE key = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "LoginFailureModel.Reset")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, query, key)
+	return err
+}
@@ -0,0 +1,66 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"testing"
+	"time"
+)
+
+func TestLoginFailures(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+		key := "user:alice@example.com"
+
+		_, err := models.LoginFailures.Get(ctx, key)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		var failure *data.LoginFailure
+		for i := 1; i <= 3; i++ {
+			failure, err = models.LoginFailures.Record(ctx, key, time.Hour)
+			assertErrorIs(t, err, nil)
+			if failure.Key != key || failure.Failures != i || failure.LastFailureAt.IsZero() || failure.LockedUntil != nil {
+				t.Fatalf("got failure %+v after %d failures", failure, i)
+			}
+		}
+
+		until := time.Now().Add(time.Hour)
+		err = models.LoginFailures.Lock(ctx, key, until)
+		assertErrorIs(t, err, nil)
+
+		failure, err = models.LoginFailures.Get(ctx, key)
+		assertErrorIs(t, err, nil)
+		if failure.Failures != 3 || !failure.Locked(time.Now()) || failure.Locked(until.Add(time.Second)) {
+			t.Fatalf("got failure %+v, want 3 failures locked for an hour", failure)
+		}
+
+		// Recording another failure keeps the lock.
+		failure, err = models.LoginFailures.Record(ctx, key, time.Hour)
+		assertErrorIs(t, err, nil)
+		if failure.Failures != 4 || !failure.Locked(time.Now()) {
+			t.Fatalf("got failure %+v, want 4 failures still locked", failure)
+		}
+
+		// Failures from before the window are forgotten, along with the lock.
+		failure, err = models.LoginFailures.Record(ctx, key, 0)
+		assertErrorIs(t, err, nil)
+		if failure.Failures != 1 || failure.LockedUntil != nil {
+			t.Fatalf("got failure %+v, want a fresh count", failure)
+		}
+
+		// Locking a key without failures does nothing.
+		err = models.LoginFailures.Lock(ctx, "ip:192.0.2.1", until)
+		assertErrorIs(t, err, nil)
+		_, err = models.LoginFailures.Get(ctx, "ip:192.0.2.1")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.LoginFailures.Reset(ctx, key)
+		assertErrorIs(t, err, nil)
+
+		_, err = models.LoginFailures.Get(ctx, key)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.LoginFailures.Reset(ctx, key)
+		assertErrorIs(t, err, nil)
+	})
+}
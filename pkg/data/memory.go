@@ -0,0 +1,503 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memoryStore holds the tables behind NewMemoryModels. Every method holds mu
+// while it touches the tables, and outside a transaction also holds a read
+// lock on txMu, so a transaction holding txMu has the tables to itself.
+type memoryStore struct {
+	txMu   sync.RWMutex
+	mu     sync.Mutex
+	tables memoryTables
+}
+
+// memoryTables mirrors the PostgreSQL schema. Stored values are never
+// modified in place, only replaced, so a shallow copy of the maps is enough
+// to roll a transaction back.
+type memoryTables struct {
+	sequences       map[string]int64
+	characters      map[int64]Character
+	players         map[int64]Player
+	users           map[int64]User
+	tokens          map[string]memoryToken
+	permissions     Permissions
+	userPermissions map[memoryGrant]bool
+	apiKeys         map[int64]APIKey
+	totp            map[int64]TOTP
+	recoveryCodes   map[string]int64
+	loginFailures   map[string]LoginFailure
+	audit           []AuditEvent
+	identities      map[memoryIdentity]int64
+}
+
+type memoryToken struct {
+	Token
+	used bool
+}
+
+type memoryGrant struct {
+	userID int64
+	code   string
+}
+
+type memoryIdentity struct {
+	provider string
+	subject  string
+}
+
+func newMemoryTables() memoryTables {
+	return memoryTables{
+		sequences:  map[string]int64{},
+		characters: map[int64]Character{},
+		players:    map[int64]Player{},
+		users:      map[int64]User{},
+		tokens:     map[string]memoryToken{},
+		// The same permissions, in the same order, as the migrations insert.
+		permissions:     Permissions{"characters:read", "characters:write", "players:read", "players:write", "admin:logging"},
+		userPermissions: map[memoryGrant]bool{},
+		apiKeys:         map[int64]APIKey{},
+		totp:            map[int64]TOTP{},
+		recoveryCodes:   map[string]int64{},
+		loginFailures:   map[string]LoginFailure{},
+		identities:      map[memoryIdentity]int64{},
+	}
+}
+
+func (t memoryTables) clone() memoryTables {
+	return memoryTables{
+		sequences:       maps.Clone(t.sequences),
+		characters:      maps.Clone(t.characters),
+		players:         maps.Clone(t.players),
+		users:           maps.Clone(t.users),
+		tokens:          maps.Clone(t.tokens),
+		permissions:     t.permissions,
+		userPermissions: maps.Clone(t.userPermissions),
+		apiKeys:         maps.Clone(t.apiKeys),
+		totp:            maps.Clone(t.totp),
+		recoveryCodes:   maps.Clone(t.recoveryCodes),
+		loginFailures:   maps.Clone(t.loginFailures),
+		audit:           slices.Clone(t.audit),
+		identities:      maps.Clone(t.identities),
+	}
+}
+
+// nextID works like a bigserial column: ids start at 1 and are never reused.
+func (t memoryTables) nextID(table string) int64 {
+	t.sequences[table]++
+	return t.sequences[table]
+}
+
+// withTx runs fn with the tables to itself, putting them back as they were
+// if it fails.
+func (s *memoryStore) withTx(fn func() error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	saved := s.tables.clone()
+	s.mu.Unlock()
+
+	err := fn()
+	if err != nil {
+		s.mu.Lock()
+		s.tables = saved
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+// NewMemoryModels returns models which keep everything in memory, for demos
+// and tests. They follow the PostgreSQL models closely, including unique
+// constraints and the filtering, sorting and pagination of GetAll, but don't
+// enforce foreign keys. Text is compared byte by byte rather than with the
+// database's collation.
+func NewMemoryModels() Models {
+	s := &memoryStore{tables: newMemoryTables()}
+	m := newMemoryModels(s, false)
+	m.memory = s
+	return m
+}
+
+func newMemoryModels(s *memoryStore, inTx bool) Models {
+	base := memoryModel{store: s, inTx: inTx}
+	return Models{
+		Characters:    memoryCharacterModel{base},
+		Players:       memoryPlayerModel{base},
+		Permissions:   memoryPermissionModel{base},
+		Tokens:        memoryTokenModel{base},
+		Users:         memoryUserModel{base},
+		APIKeys:       memoryAPIKeyModel{base},
+		MFA:           memoryMFAModel{base},
+		LoginFailures: memoryLoginFailureModel{base},
+		Audit:         memoryAuditModel{base},
+		Identities:    memoryIdentityModel{base},
+	}
+}
+
+type memoryModel struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// lock gives the caller the tables until the returned function is called.
+func (m memoryModel) lock() func() {
+	if !m.inTx {
+		m.store.txMu.RLock()
+	}
+	m.store.mu.Lock()
+
+	return func() {
+		m.store.mu.Unlock()
+		if !m.inTx {
+			m.store.txMu.RUnlock()
+		}
+	}
+}
+
+func (m memoryModel) tables() *memoryTables {
+	return &m.store.tables
+}
+
+// memoryNow matches the timestamp(0) created_at columns.
+func memoryNow() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+func uniqueViolation(table, constraint, column string) error {
+	return &ConstraintError{
+		Kind:       ConstraintUnique,
+		Table:      table,
+		Constraint: constraint,
+		Column:     column,
+		Err:        errors.New("duplicate key value violates unique constraint"),
+	}
+}
+
+// matchesText approximates to_tsvector('simple', text) @@
+// plainto_tsquery('simple', query): every word of the query has to appear as
+// a word of the text.
+func matchesText(text, query string) bool {
+	if query == "" {
+		return true
+	}
+
+	words := textSearchWords(query)
+	if len(words) == 0 {
+		return false
+	}
+
+	have := textSearchWords(text)
+	for _, word := range words {
+		if !slices.Contains(have, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func textSearchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsAll matches roles @> want.
+func containsAll(roles, want []string) bool {
+	for _, role := range want {
+		if !slices.Contains(roles, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRows orders rows by the filters' sort column, breaking ties by id as
+// the queries do.
+func sortRows[T any](rows []*T, filters Filters, compare func(column string, a, b *T) int, id func(*T) int64) {
+	column := filters.sortColumn()
+	desc := filters.sortDirection() == "DESC"
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := compare(column, rows[i], rows[j])
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return id(rows[i]) < id(rows[j])
+		}
+		return c < 0
+	})
+}
+
+// paginate returns the filters' page of rows. Like count(*) OVER(), the total
+// is only known when the page has rows in it.
+func paginate[T any](rows []*T, filters Filters) ([]*T, Metadata) {
+	offset := filters.offset()
+	if offset >= len(rows) {
+		return []*T{}, Metadata{}
+	}
+
+	end := min(offset+filters.limit(), len(rows))
+	return rows[offset:end], calculateMetadata(len(rows), filters.Page, filters.PageSize)
+}
+
+type memoryCharacterModel struct {
+	memoryModel
+}
+
+func (m memoryCharacterModel) slugTaken(slug string, exceptID int64) bool {
+	for id, character := range m.tables().characters {
+		if character.Slug == slug && id != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memoryCharacterModel) save(character *Character) {
+	stored := *character
+	stored.Roles = slices.Clone(character.Roles)
+	m.tables().characters[character.ID] = stored
+}
+
+func (m memoryCharacterModel) Insert(ctx context.Context, character *Character) error {
+	defer m.lock()()
+
+	if m.slugTaken(character.Slug, 0) {
+		return uniqueViolation("characters", "characters_slug_key", "slug")
+	}
+
+	character.ID = m.tables().nextID("characters")
+	character.CreatedAt = memoryNow()
+	m.save(character)
+	return nil
+}
+
+func (m memoryCharacterModel) Upsert(ctx context.Context, character *Character) (bool, error) {
+	defer m.lock()()
+
+	for id, existing := range m.tables().characters {
+		if existing.Slug == character.Slug {
+			character.ID = id
+			character.CreatedAt = existing.CreatedAt
+			m.save(character)
+			return false, nil
+		}
+	}
+
+	character.ID = m.tables().nextID("characters")
+	character.CreatedAt = memoryNow()
+	m.save(character)
+	return true, nil
+}
+
+func (m memoryCharacterModel) Get(ctx context.Context, id int64) (*Character, error) {
+	defer m.lock()()
+
+	character, ok := m.tables().characters[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	character.Roles = slices.Clone(character.Roles)
+	return &character, nil
+}
+
+func (m memoryCharacterModel) GetBySlug(ctx context.Context, slug string) (*Character, error) {
+	defer m.lock()()
+
+	slug = strings.ToLower(slug)
+	for _, character := range m.tables().characters {
+		if character.Slug == slug {
+			character.Roles = slices.Clone(character.Roles)
+			return &character, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryCharacterModel) Update(ctx context.Context, character *Character) error {
+	defer m.lock()()
+
+	existing, ok := m.tables().characters[character.ID]
+	if !ok {
+		return ErrEditConflict
+	}
+
+	if m.slugTaken(character.Slug, character.ID) {
+		return uniqueViolation("characters", "characters_slug_key", "slug")
+	}
+
+	character.CreatedAt = existing.CreatedAt
+	m.save(character)
+	return nil
+}
+
+func (m memoryCharacterModel) Delete(ctx context.Context, id int64) error {
+	defer m.lock()()
+
+	if _, ok := m.tables().characters[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.tables().characters, id)
+	return nil
+}
+
+func (m memoryCharacterModel) GetAll(ctx context.Context, Name string, Roles []string, filters Filters) ([]*Character, Metadata, error) {
+	defer m.lock()()
+
+	characters := []*Character{}
+	for _, character := range m.tables().characters {
+		if matchesText(character.Name, Name) && containsAll(character.Roles, Roles) {
+			character := character
+			character.Roles = slices.Clone(character.Roles)
+			characters = append(characters, &character)
+		}
+	}
+
+	sortRows(characters, filters, compareCharacters, func(c *Character) int64 { return c.ID })
+
+	characters, metadata := paginate(characters, filters)
+	return characters, metadata, nil
+}
+
+func compareCharacters(column string, a, b *Character) int {
+	switch column {
+	case "id":
+		return cmp.Compare(a.ID, b.ID)
+	case "names":
+		return strings.Compare(a.Name, b.Name)
+	case "health":
+		return cmp.Compare(a.Health, b.Health)
+	case "movespeed":
+		return cmp.Compare(a.MoveSpeed, b.MoveSpeed)
+	case "mana":
+		return cmp.Compare(a.Mana, b.Mana)
+	case "roles":
+		return slices.Compare(a.Roles, b.Roles)
+	default:
+		panic("unknown character sort column: " + column)
+	}
+}
+
+type memoryPlayerModel struct {
+	memoryModel
+}
+
+func (m memoryPlayerModel) save(player *Player) {
+	stored := *player
+	stored.Roles = slices.Clone(player.Roles)
+	m.tables().players[player.PlayerID] = stored
+}
+
+func (m memoryPlayerModel) Insert(ctx context.Context, player *Player) error {
+	defer m.lock()()
+
+	player.PlayerID = m.tables().nextID("players")
+	player.CreatedAt = memoryNow()
+	m.save(player)
+	return nil
+}
+
+func (m memoryPlayerModel) Get(ctx context.Context, playerid int64) (*Player, error) {
+	defer m.lock()()
+
+	player, ok := m.tables().players[playerid]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	player.Roles = slices.Clone(player.Roles)
+	return &player, nil
+}
+
+func (m memoryPlayerModel) GetByNickname(ctx context.Context, nickname string) (*Player, error) {
+	defer m.lock()()
+
+	var found *Player
+	for _, player := range m.tables().players {
+		if strings.EqualFold(player.Nickname, nickname) && (found == nil || player.PlayerID < found.PlayerID) {
+			player := player
+			player.Roles = slices.Clone(player.Roles)
+			found = &player
+		}
+	}
+
+	if found == nil {
+		return nil, ErrRecordNotFound
+	}
+	return found, nil
+}
+
+func (m memoryPlayerModel) Update(ctx context.Context, player *Player) error {
+	defer m.lock()()
+
+	existing, ok := m.tables().players[player.PlayerID]
+	if !ok {
+		return ErrEditConflict
+	}
+
+	player.CreatedAt = existing.CreatedAt
+	m.save(player)
+	return nil
+}
+
+func (m memoryPlayerModel) Delete(ctx context.Context, playerid int64) error {
+	defer m.lock()()
+
+	if _, ok := m.tables().players[playerid]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.tables().players, playerid)
+	return nil
+}
+
+func (m memoryPlayerModel) GetAll(ctx context.Context, Nickname string, Roles []string, filters Filters) ([]*Player, Metadata, error) {
+	defer m.lock()()
+
+	players := []*Player{}
+	for _, player := range m.tables().players {
+		if matchesText(player.Nickname, Nickname) && containsAll(player.Roles, Roles) {
+			player := player
+			player.Roles = slices.Clone(player.Roles)
+			players = append(players, &player)
+		}
+	}
+
+	sortRows(players, filters, comparePlayers, func(p *Player) int64 { return p.PlayerID })
+
+	players, metadata := paginate(players, filters)
+	return players, metadata, nil
+}
+
+func comparePlayers(column string, a, b *Player) int {
+	switch column {
+	case "playerid":
+		return cmp.Compare(a.PlayerID, b.PlayerID)
+	case "nicknames":
+		return strings.Compare(a.Nickname, b.Nickname)
+	case "mmr":
+		return cmp.Compare(a.MMR, b.MMR)
+	case "winrate":
+		return cmp.Compare(a.WinRate, b.WinRate)
+	case "totalmatches":
+		return cmp.Compare(a.TotalMatches, b.TotalMatches)
+	default:
+		panic("unknown player sort column: " + column)
+	}
+}
@@ -0,0 +1,585 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryUserModel struct {
+	memoryModel
+}
+
+func (m memoryUserModel) emailTaken(email string, exceptID int64) bool {
+	for id, user := range m.tables().users {
+		if strings.EqualFold(user.Email, email) && id != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// save stores the user as the database would, without the plaintext
+// password.
+func (m memoryUserModel) save(user *User) {
+	stored := *user
+	stored.Password = password{hash: user.Password.hash}
+	m.tables().users[user.ID] = stored
+}
+
+func (m memoryUserModel) Insert(ctx context.Context, user *User) error {
+	defer m.lock()()
+
+	if m.emailTaken(user.Email, 0) {
+		return uniqueViolation("users", "users_email_key", "email")
+	}
+
+	user.ID = m.tables().nextID("users")
+	user.CreatedAt = memoryNow()
+	user.Version = 1
+	m.save(user)
+	return nil
+}
+
+func (m memoryUserModel) Get(ctx context.Context, id int64) (*User, error) {
+	defer m.lock()()
+
+	user, ok := m.tables().users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (m memoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	defer m.lock()()
+
+	for _, user := range m.tables().users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryUserModel) GetAll(ctx context.Context) ([]*User, error) {
+	defer m.lock()()
+
+	users := []*User{}
+	for _, user := range m.tables().users {
+		user := user
+		users = append(users, &user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (m memoryUserModel) Update(ctx context.Context, user *User) error {
+	defer m.lock()()
+
+	existing, ok := m.tables().users[user.ID]
+	if !ok || existing.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	if m.emailTaken(user.Email, user.ID) {
+		return uniqueViolation("users", "users_email_key", "email")
+	}
+
+	user.Version++
+	m.save(user)
+	return nil
+}
+
+func (m memoryUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	defer m.lock()()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	token, ok := m.tables().tokens[string(tokenHash[:])]
+	if !ok || token.Scope != tokenScope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.tables().users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+type memoryTokenModel struct {
+	memoryModel
+}
+
+func (m memoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokenModel) NewForFamily(ctx context.Context, userID int64, ttl time.Duration, scope, family string) (*Token, error) {
+	if family == "" {
+		var err error
+		family, err = generateFamily()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Family = family
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokenModel) NewPair(ctx context.Context, userID int64, accessTTL, refreshTTL time.Duration, family string) (*Token, *Token, error) {
+	refresh, err := m.NewForFamily(ctx, userID, refreshTTL, ScopeRefresh, family)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, err := m.NewForFamily(ctx, userID, accessTTL, ScopeAuthentication, refresh.Family)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, nil
+}
+
+func (m memoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	defer m.lock()()
+
+	stored := *token
+	stored.Plaintext = ""
+	m.tables().tokens[string(token.Hash)] = memoryToken{Token: stored}
+	return nil
+}
+
+func (m memoryTokenModel) UseRefresh(ctx context.Context, tokenPlaintext string) (*Token, error) {
+	defer m.lock()()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	stored, ok := m.tables().tokens[string(tokenHash[:])]
+	if !ok || stored.Scope != ScopeRefresh {
+		return nil, ErrRecordNotFound
+	}
+
+	token := stored.Token
+	token.Plaintext = tokenPlaintext
+
+	if stored.used {
+		m.deleteFamily(token.Family)
+		return &token, ErrRefreshTokenReused
+	}
+
+	if !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	stored.used = true
+	m.tables().tokens[string(tokenHash[:])] = stored
+	return &token, nil
+}
+
+// deleteFamily treats an empty family like the NULL the database stores for
+// it, which matches nothing.
+func (m memoryTokenModel) deleteFamily(family string) {
+	if family == "" {
+		return
+	}
+
+	for hash, token := range m.tables().tokens {
+		if token.Family == family {
+			delete(m.tables().tokens, hash)
+		}
+	}
+}
+
+func (m memoryTokenModel) DeleteFamily(ctx context.Context, family string) error {
+	defer m.lock()()
+
+	m.deleteFamily(family)
+	return nil
+}
+
+func (m memoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	defer m.lock()()
+
+	for hash, token := range m.tables().tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.tables().tokens, hash)
+		}
+	}
+	return nil
+}
+
+type memoryPermissionModel struct {
+	memoryModel
+}
+
+func (m memoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	defer m.lock()()
+
+	var permissions Permissions
+	for _, code := range m.tables().permissions {
+		if m.tables().userPermissions[memoryGrant{userID, code}] {
+			permissions = append(permissions, code)
+		}
+	}
+	return permissions, nil
+}
+
+func (m memoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	defer m.lock()()
+
+	var grants []memoryGrant
+	for _, code := range m.tables().permissions {
+		if slices.Contains(codes, code) {
+			grant := memoryGrant{userID, code}
+			if m.tables().userPermissions[grant] {
+				return uniqueViolation("users_permissions", "users_permissions_pkey", "")
+			}
+			grants = append(grants, grant)
+		}
+	}
+
+	for _, grant := range grants {
+		m.tables().userPermissions[grant] = true
+	}
+	return nil
+}
+
+func (m memoryPermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	defer m.lock()()
+
+	for _, code := range codes {
+		delete(m.tables().userPermissions, memoryGrant{userID, code})
+	}
+	return nil
+}
+
+func (m memoryPermissionModel) GetAll(ctx context.Context) (Permissions, error) {
+	defer m.lock()()
+
+	permissions := slices.Clone(m.tables().permissions)
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+type memoryAPIKeyModel struct {
+	memoryModel
+}
+
+func (m memoryAPIKeyModel) New(ctx context.Context, userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	token, err := generateToken(userID, 0, ScopeAPIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &APIKey{
+		Name:        name,
+		Plaintext:   APIKeyPrefix + token.Plaintext,
+		UserID:      userID,
+		Permissions: permissions,
+		Expiry:      expiry,
+	}
+
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	err = m.Insert(ctx, key)
+	return key, err
+}
+
+func (m memoryAPIKeyModel) Insert(ctx context.Context, key *APIKey) error {
+	defer m.lock()()
+
+	for _, existing := range m.tables().apiKeys {
+		if existing.UserID == key.UserID && existing.Name == key.Name {
+			return uniqueViolation("api_keys", "api_keys_user_id_name_key", "")
+		}
+	}
+
+	key.ID = m.tables().nextID("api_keys")
+	key.CreatedAt = memoryNow()
+
+	stored := *key
+	stored.Plaintext = ""
+	stored.Permissions = slices.Clone(key.Permissions)
+	m.tables().apiKeys[key.ID] = stored
+	return nil
+}
+
+// loaded returns a copy of a stored key with the columns the queries read.
+func (m memoryAPIKeyModel) loaded(key APIKey) *APIKey {
+	key.Hash = nil
+	key.Permissions = slices.Clone(key.Permissions)
+	return &key
+}
+
+func (m memoryAPIKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	defer m.lock()()
+
+	keys := []*APIKey{}
+	for _, key := range m.tables().apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, m.loaded(key))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (m memoryAPIKeyModel) GetForKey(ctx context.Context, keyPlaintext string) (*APIKey, *User, error) {
+	defer m.lock()()
+
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+	now := time.Now()
+
+	for id, key := range m.tables().apiKeys {
+		if string(key.Hash) != string(keyHash[:]) || (key.Expiry != nil && !key.Expiry.After(now)) {
+			continue
+		}
+
+		user, ok := m.tables().users[key.UserID]
+		if !ok {
+			break
+		}
+
+		key.LastUsedAt = &now
+		m.tables().apiKeys[id] = key
+		return m.loaded(key), &user, nil
+	}
+
+	return nil, nil, ErrRecordNotFound
+}
+
+func (m memoryAPIKeyModel) Delete(ctx context.Context, id, userID int64) error {
+	defer m.lock()()
+
+	key, ok := m.tables().apiKeys[id]
+	if !ok || key.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.tables().apiKeys, id)
+	return nil
+}
+
+type memoryMFAModel struct {
+	memoryModel
+}
+
+func (m memoryMFAModel) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	defer m.lock()()
+
+	totp, ok := m.tables().totp[userID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &totp, nil
+}
+
+func (m memoryMFAModel) SetTOTP(ctx context.Context, userID int64, secret string) error {
+	defer m.lock()()
+
+	if existing, ok := m.tables().totp[userID]; ok && existing.Confirmed {
+		return nil
+	}
+
+	m.tables().totp[userID] = TOTP{
+		UserID:    userID,
+		CreatedAt: memoryNow(),
+		Secret:    secret,
+	}
+	return nil
+}
+
+func (m memoryMFAModel) ConfirmTOTP(ctx context.Context, userID int64, step int64) error {
+	defer m.lock()()
+
+	totp, ok := m.tables().totp[userID]
+	if !ok || totp.Confirmed {
+		return ErrRecordNotFound
+	}
+
+	totp.Confirmed = true
+	totp.LastUsedStep = step
+	m.tables().totp[userID] = totp
+	return nil
+}
+
+func (m memoryMFAModel) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	defer m.lock()()
+
+	totp, ok := m.tables().totp[userID]
+	if !ok || !totp.Confirmed || totp.LastUsedStep >= step {
+		return ErrRecordNotFound
+	}
+
+	totp.LastUsedStep = step
+	m.tables().totp[userID] = totp
+	return nil
+}
+
+func (m memoryMFAModel) deleteRecoveryCodes(userID int64) {
+	maps.DeleteFunc(m.tables().recoveryCodes, func(_ string, owner int64) bool {
+		return owner == userID
+	})
+}
+
+func (m memoryMFAModel) DeleteTOTP(ctx context.Context, userID int64) error {
+	defer m.lock()()
+
+	m.deleteRecoveryCodes(userID)
+	delete(m.tables().totp, userID)
+	return nil
+}
+
+func (m memoryMFAModel) NewRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	defer m.lock()()
+
+	m.deleteRecoveryCodes(userID)
+	for _, code := range codes {
+		hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+		m.tables().recoveryCodes[string(hash[:])] = userID
+	}
+
+	return codes, nil
+}
+
+func (m memoryMFAModel) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	defer m.lock()()
+
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+
+	owner, ok := m.tables().recoveryCodes[string(hash[:])]
+	if !ok || owner != userID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.tables().recoveryCodes, string(hash[:]))
+	return nil
+}
+
+type memoryLoginFailureModel struct {
+	memoryModel
+}
+
+func (m memoryLoginFailureModel) Get(ctx context.Context, key string) (*LoginFailure, error) {
+	defer m.lock()()
+
+	failure, ok := m.tables().loginFailures[key]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &failure, nil
+}
+
+func (m memoryLoginFailureModel) Record(ctx context.Context, key string, window time.Duration) (*LoginFailure, error) {
+	defer m.lock()()
+
+	now := time.Now()
+
+	failure, ok := m.tables().loginFailures[key]
+	switch {
+	case !ok:
+		failure = LoginFailure{Key: key, Failures: 1}
+	case failure.LastFailureAt.Before(now.Add(-window)):
+		failure.Failures = 1
+		failure.LockedUntil = nil
+	default:
+		failure.Failures++
+	}
+	failure.LastFailureAt = now
+
+	m.tables().loginFailures[key] = failure
+	return &failure, nil
+}
+
+func (m memoryLoginFailureModel) Lock(ctx context.Context, key string, until time.Time) error {
+	defer m.lock()()
+
+	failure, ok := m.tables().loginFailures[key]
+	if ok {
+		failure.LockedUntil = &until
+		m.tables().loginFailures[key] = failure
+	}
+	return nil
+}
+
+func (m memoryLoginFailureModel) Reset(ctx context.Context, key string) error {
+	defer m.lock()()
+
+	delete(m.tables().loginFailures, key)
+	return nil
+}
+
+type memoryAuditModel struct {
+	memoryModel
+}
+
+func (m memoryAuditModel) Insert(ctx context.Context, event *AuditEvent) error {
+	defer m.lock()()
+
+	event.ID = m.tables().nextID("audit_events")
+	event.CreatedAt = memoryNow()
+
+	stored := *event
+	stored.Details = maps.Clone(event.Details)
+	m.tables().audit = append(m.tables().audit, stored)
+	return nil
+}
+
+type memoryIdentityModel struct {
+	memoryModel
+}
+
+func (m memoryIdentityModel) GetUser(ctx context.Context, provider, subject string) (*User, error) {
+	defer m.lock()()
+
+	userID, ok := m.tables().identities[memoryIdentity{provider, subject}]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.tables().users[userID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (m memoryIdentityModel) Insert(ctx context.Context, provider, subject string, userID int64) error {
+	defer m.lock()()
+
+	identity := memoryIdentity{provider, subject}
+	if _, ok := m.tables().identities[identity]; !ok {
+		m.tables().identities[identity] = userID
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is the number of single-use codes handed out when
+// two-factor authentication is enabled.
+const RecoveryCodeCount = 10
+
+type TOTP struct {
+	UserID       int64
+	CreatedAt    time.Time
+	Secret       string
+	Confirmed    bool
+	LastUsedStep int64
+}
+
+// normalizeRecoveryCode lets users type codes with or without the dashes and
+// in any case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToUpper(code)
+}
+
+func generateRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 10)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// 16 characters, shown as XXXX-XXXX-XXXX-XXXX.
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+type MFAModel struct {
+	DB Querier
+	Timeout time.Duration
+}
+
+func (m MFAModel) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	query := `
+	SELECT user_id, created_at, secret, confirmed, last_used_step
+	FROM users_totp
+	WHERE user_id = $1`
+
+	var totp TOTP
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.GetTOTP")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.CreatedAt,
+		&totp.Secret,
+		&totp.Confirmed,
+		&totp.LastUsedStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+// SetTOTP stores a new, unconfirmed secret for the user, replacing any
+// previous enrollment which was never confirmed.
+func (m MFAModel) SetTOTP(ctx context.Context, userID int64, secret string) error {
+	query := `
+	INSERT INTO users_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+	WHERE NOT users_totp.confirmed`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.SetTOTP")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+func (m MFAModel) ConfirmTOTP(ctx context.Context, userID int64, step int64) error {
+	query := `
+	UPDATE users_totp
+	SET confirmed = true, last_used_step = $2
+	WHERE user_id = $1 AND NOT confirmed`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.ConfirmTOTP")
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code for step has been used. It returns
+// ErrRecordNotFound if that step, or a later one, was already used, which
+// stops a captured code from being replayed.
+func (m MFAModel) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	query := `
+	UPDATE users_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND confirmed AND last_used_step < $2`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.UseTOTPStep")
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m MFAModel) DeleteTOTP(ctx context.Context, userID int64) error {
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.DeleteTOTP")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM users_totp WHERE user_id = $1`, userID)
+	return err
+}
+
+// NewRecoveryCodes replaces the user's recovery codes with a fresh set and
+// returns their plaintext. Only hashes are stored.
+func (m MFAModel) NewRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([][]byte, RecoveryCodeCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+		codes[i] = code
+		hashes[i] = hash[:]
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.NewRecoveryCodes")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		_, err = m.DB.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hash, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes, returning
+// ErrRecordNotFound if it doesn't match an unused code.
+func (m MFAModel) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+
+	query := `
+	DELETE FROM recovery_codes
+	WHERE hash = $1 AND user_id = $2`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "MFAModel.UseRecoveryCode")
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, hash[:], userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"goproject/pkg/data"
+	"strings"
+	"testing"
+)
+
+func TestTOTP(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+
+		_, err := models.MFA.GetTOTP(ctx, alice.ID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.MFA.ConfirmTOTP(ctx, alice.ID, 100)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.MFA.SetTOTP(ctx, alice.ID, "FIRSTSECRET")
+		assertErrorIs(t, err, nil)
+
+		// Enrolling again before confirming replaces the secret.
+		err = models.MFA.SetTOTP(ctx, alice.ID, "SECONDSECRET")
+		assertErrorIs(t, err, nil)
+
+		totp, err := models.MFA.GetTOTP(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if totp.UserID != alice.ID || totp.Secret != "SECONDSECRET" || totp.Confirmed || totp.CreatedAt.IsZero() {
+			t.Fatalf("got totp %+v, want the second secret unconfirmed", totp)
+		}
+
+		// Steps can't be used until enrollment is confirmed.
+		err = models.MFA.UseTOTPStep(ctx, alice.ID, 99)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.MFA.ConfirmTOTP(ctx, alice.ID, 100)
+		assertErrorIs(t, err, nil)
+
+		err = models.MFA.ConfirmTOTP(ctx, alice.ID, 101)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		// A confirmed secret is kept.
+		err = models.MFA.SetTOTP(ctx, alice.ID, "THIRDSECRET")
+		assertErrorIs(t, err, nil)
+
+		totp, err = models.MFA.GetTOTP(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if totp.Secret != "SECONDSECRET" || !totp.Confirmed || totp.LastUsedStep != 100 {
+			t.Fatalf("got totp %+v, want the second secret confirmed at step 100", totp)
+		}
+
+		tests := []struct {
+			step int64
+			want error
+		}{
+			{99, data.ErrRecordNotFound},
+			{100, data.ErrRecordNotFound},
+			{101, nil},
+			{101, data.ErrRecordNotFound},
+			{103, nil},
+		}
+
+		for _, tt := range tests {
+			err = models.MFA.UseTOTPStep(ctx, alice.ID, tt.step)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("step %d: got error %v, want %v", tt.step, err, tt.want)
+			}
+		}
+
+		err = models.MFA.DeleteTOTP(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+
+		_, err = models.MFA.GetTOTP(ctx, alice.ID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+		bob := insertTestUser(t, models, "bob@example.com")
+
+		err := models.MFA.SetTOTP(ctx, alice.ID, "SECRET")
+		assertErrorIs(t, err, nil)
+
+		codes, err := models.MFA.NewRecoveryCodes(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if len(codes) != data.RecoveryCodeCount {
+			t.Fatalf("got %d recovery codes, want %d", len(codes), data.RecoveryCodeCount)
+		}
+
+		bobCodes, err := models.MFA.NewRecoveryCodes(ctx, bob.ID)
+		assertErrorIs(t, err, nil)
+
+		// Codes can be typed without dashes and in any case.
+		typed := strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))
+
+		err = models.MFA.UseRecoveryCode(ctx, alice.ID, typed)
+		assertErrorIs(t, err, nil)
+
+		err = models.MFA.UseRecoveryCode(ctx, alice.ID, codes[0])
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.MFA.UseRecoveryCode(ctx, alice.ID, bobCodes[0])
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		// A new set replaces the old one.
+		newCodes, err := models.MFA.NewRecoveryCodes(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+
+		err = models.MFA.UseRecoveryCode(ctx, alice.ID, codes[1])
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.MFA.UseRecoveryCode(ctx, alice.ID, newCodes[1])
+		assertErrorIs(t, err, nil)
+
+		// Disabling two-factor authentication removes the codes too.
+		err = models.MFA.DeleteTOTP(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+
+		err = models.MFA.UseRecoveryCode(ctx, alice.ID, newCodes[2])
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.MFA.UseRecoveryCode(ctx, bob.ID, bobCodes[0])
+		assertErrorIs(t, err, nil)
+	})
+}
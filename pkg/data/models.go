@@ -1,8 +1,11 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var (
@@ -13,30 +16,177 @@ var (
 
 type Models struct {
 	Characters interface {
-		Insert(character *Character) error
-		Get(id int64) (*Character, error)
-		Update(character *Character) error
-		Delete(id int64) error
-		GetAll(Name string, Roles []string, filters Filters) ([]*Character, Metadata,error)
+		Insert(ctx context.Context, character *Character) error
+		Get(ctx context.Context, id int64) (*Character, error)
+		GetBySlug(ctx context.Context, slug string) (*Character, error)
+		Upsert(ctx context.Context, character *Character) (bool, error)
+		Update(ctx context.Context, character *Character) error
+		Delete(ctx context.Context, id int64) error
+		GetAll(ctx context.Context, Name string, Roles []string, filters Filters) ([]*Character, Metadata,error)
 	}
 	Players interface{
-		Insert(player *Player) error
-		Get(playerid int64) (*Player, error)
-		Update(player *Player) error
-		Delete(playerid int64) error
-		GetAll(Nickname string, Roles []string, filters Filters) ([]*Player,Metadata,error)
-	}
-	Users UserModel 
-	Tokens TokenModel
-	Permissions PermissionModel
+		Insert(ctx context.Context, player *Player) error
+		Get(ctx context.Context, playerid int64) (*Player, error)
+		GetByNickname(ctx context.Context, nickname string) (*Player, error)
+		Update(ctx context.Context, player *Player) error
+		Delete(ctx context.Context, playerid int64) error
+		GetAll(ctx context.Context, Nickname string, Roles []string, filters Filters) ([]*Player,Metadata,error)
+	}
+	Users interface {
+		Insert(ctx context.Context, user *User) error
+		Get(ctx context.Context, id int64) (*User, error)
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		GetAll(ctx context.Context) ([]*User, error)
+		Update(ctx context.Context, user *User) error
+		GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+	}
+	Tokens interface {
+		New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+		NewForFamily(ctx context.Context, userID int64, ttl time.Duration, scope, family string) (*Token, error)
+		NewPair(ctx context.Context, userID int64, accessTTL, refreshTTL time.Duration, family string) (*Token, *Token, error)
+		Insert(ctx context.Context, token *Token) error
+		UseRefresh(ctx context.Context, tokenPlaintext string) (*Token, error)
+		DeleteFamily(ctx context.Context, family string) error
+		DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	}
+	Permissions interface {
+		GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+		AddForUser(ctx context.Context, userID int64, codes ...string) error
+		RemoveForUser(ctx context.Context, userID int64, codes ...string) error
+		GetAll(ctx context.Context) (Permissions, error)
+	}
+	APIKeys interface {
+		New(ctx context.Context, userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error)
+		Insert(ctx context.Context, key *APIKey) error
+		GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error)
+		GetForKey(ctx context.Context, keyPlaintext string) (*APIKey, *User, error)
+		Delete(ctx context.Context, id, userID int64) error
+	}
+	MFA interface {
+		GetTOTP(ctx context.Context, userID int64) (*TOTP, error)
+		SetTOTP(ctx context.Context, userID int64, secret string) error
+		ConfirmTOTP(ctx context.Context, userID int64, step int64) error
+		UseTOTPStep(ctx context.Context, userID int64, step int64) error
+		DeleteTOTP(ctx context.Context, userID int64) error
+		NewRecoveryCodes(ctx context.Context, userID int64) ([]string, error)
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+	}
+	LoginFailures interface {
+		Get(ctx context.Context, key string) (*LoginFailure, error)
+		Record(ctx context.Context, key string, window time.Duration) (*LoginFailure, error)
+		Lock(ctx context.Context, key string, until time.Time) error
+		Reset(ctx context.Context, key string) error
+	}
+	Audit interface {
+		Insert(ctx context.Context, event *AuditEvent) error
+	}
+	Identities interface {
+		GetUser(ctx context.Context, provider, subject string) (*User, error)
+		Insert(ctx context.Context, provider, subject string, userID int64) error
+	}
+
+	db *sql.DB
+	memory *memoryStore
+	timeout time.Duration
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so the same model can run
+// its queries inside or outside a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// DefaultQueryTimeout bounds each model method when no timeout is configured.
+const DefaultQueryTimeout = 3 * time.Second
+
+// withQueryTimeout bounds a model method's queries. The deadline is added to
+// the caller's context, so the queries are also cancelled when it is.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func NewModels(db *sql.DB, timeout time.Duration) Models {
+	m := newModels(db, timeout)
+	m.db = db
+	return m
 }
 
-func NewModels(db *sql.DB) Models {
+func newModels(db Querier, timeout time.Duration) Models {
 	return Models{
-		Characters: MockCharacterModel{DB: db},
-		Players: MockPlayerModel{DB: db},
-		Permissions: PermissionModel{DB: db}, 
-		Tokens: TokenModel{DB: db},
-		Users: UserModel{DB: db},
+		Characters: CharacterModel{DB: db, Timeout: timeout},
+		Players: PlayerModel{DB: db, Timeout: timeout},
+		Permissions: PermissionModel{DB: db, Timeout: timeout}, 
+		Tokens: TokenModel{DB: db, Timeout: timeout},
+		Users: UserModel{DB: db, Timeout: timeout},
+		APIKeys: APIKeyModel{DB: db, Timeout: timeout},
+		MFA: MFAModel{DB: db, Timeout: timeout},
+		LoginFailures: LoginFailureModel{DB: db, Timeout: timeout},
+		Audit: AuditModel{DB: db, Timeout: timeout},
+		Identities: IdentityModel{DB: db, Timeout: timeout},
+		timeout: timeout,
 	}
-}
\ No newline at end of file
+}
+
+// txAttempts is how many times WithTx runs fn before giving up on
+// serialization failures.
+const txAttempts = 3
+
+// WithTx runs fn in a serializable transaction, passing it models whose
+// queries all go through that transaction. The transaction is committed if
+// fn returns nil and rolled back otherwise. When it fails because of a
+// concurrent transaction the whole of fn is run again, so fn must not have
+// side effects outside the database, such as sending mail.
+//
+// Calling WithTx on models which are already in a transaction just runs fn
+// as part of it. With NewMemoryModels, fn has to use only the models it is
+// given, since other callers wait until the transaction finishes.
+func (m Models) WithTx(ctx context.Context, fn func(Models) error) error {
+	if m.memory != nil {
+		return m.memory.withTx(func() error {
+			return fn(newMemoryModels(m.memory, true))
+		})
+	}
+	if m.db == nil {
+		return fn(m)
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= txAttempts; attempt++ {
+		err = m.runTx(ctx, fn)
+		if !isSerializationFailure(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+
+	if !errors.Is(err, ErrSerializationFailure) {
+		err = fmt.Errorf("%w: %w", ErrSerializationFailure, err)
+	}
+	return err
+}
+
+func (m Models) runTx(ctx context.Context, fn func(Models) error) error {
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(newModels(tx, m.timeout))
+	if err != nil {
+		return err
+	}
+
+	return translateError(tx.Commit())
+}
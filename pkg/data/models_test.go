@@ -0,0 +1,237 @@
+package data_test
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"goproject/pkg/data"
+	"goproject/pkg/migrations"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testDSNEnv names the variable holding the DSN of a PostgreSQL database the
+// tests may create schemas in. Without it only the in-memory models are
+// tested.
+const testDSNEnv = "TEST_DB_DSN"
+
+// forEachBackend runs fn against fresh in-memory models and against the
+// PostgreSQL models in a throwaway schema, so both are held to the same
+// behaviour.
+func forEachBackend(t *testing.T, fn func(t *testing.T, models data.Models)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, data.NewMemoryModels())
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		fn(t, newPostgresModels(t))
+	})
+}
+
+// newPostgresModels creates a schema with every migration applied and returns
+// models which use it. The schema is dropped when the test finishes. The test
+// is skipped when no DSN is set.
+func newPostgresModels(t *testing.T) data.Models {
+	t.Helper()
+
+	db := openTestDB(t)
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("applying migrations: %v", err)
+	}
+
+	return data.NewModels(db, 0)
+}
+
+// openTestDB connects to a new, empty schema, which comes first in the
+// search_path so the migrations create their tables there.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	ctx := context.Background()
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	err = admin.PingContext(ctx)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+
+	// This only needs privileges the first time, after which it's a no-op.
+	_, err = admin.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS citext`)
+	if err != nil {
+		t.Fatalf("creating the citext extension (a superuser may need to do it first): %v", err)
+	}
+
+	b := make([]byte, 8)
+	_, err = rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(b)
+
+	_, err = admin.ExecContext(ctx, `CREATE SCHEMA `+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := admin.ExecContext(context.Background(), `DROP SCHEMA `+schema+` CASCADE`)
+		if err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cleanups run in reverse, so the pool is closed before the schema is
+	// dropped.
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// withSearchPath adds a search_path to a URL or key/value DSN. lib/pq sends
+// settings it doesn't recognise to the server as run-time parameters.
+func withSearchPath(dsn, searchPath string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", searchPath)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+
+	return dsn + " search_path=" + searchPath
+}
+
+// assertErrorIs fails the test unless err matches want, which may be nil.
+func assertErrorIs(t *testing.T, err, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+// assertConstraint fails the test unless err is a violation of the named
+// constraint.
+func assertConstraint(t *testing.T, err error, kind data.ConstraintKind, constraint string) {
+	t.Helper()
+
+	var ce *data.ConstraintError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got error %v, want a %s constraint error", err, kind)
+	}
+	if ce.Kind != kind || ce.Constraint != constraint {
+		t.Fatalf("got %s constraint %q, want %s constraint %q", ce.Kind, ce.Constraint, kind, constraint)
+	}
+}
+
+const testPassword = "pa55word1234"
+
+// insertTestUser stores an activated user with testPassword.
+func insertTestUser(t *testing.T, models data.Models, email string) *data.User {
+	t.Helper()
+
+	user := &data.User{Name: "Test User", Email: email, Activated: true}
+
+	err := user.Password.Set(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestWithTx(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+		errRollback := errors.New("roll back")
+
+		err := models.WithTx(ctx, func(tx data.Models) error {
+			err := tx.Characters.Insert(ctx, &data.Character{Slug: "axe", Name: "Axe", Health: 700, MoveSpeed: 310, Mana: 250, Roles: []string{"Initiator"}})
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		assertErrorIs(t, err, errRollback)
+
+		_, err = models.Characters.GetBySlug(ctx, "axe")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.WithTx(ctx, func(tx data.Models) error {
+			return tx.Characters.Insert(ctx, &data.Character{Slug: "axe", Name: "Axe", Health: 700, MoveSpeed: 310, Mana: 250, Roles: []string{"Initiator"}})
+		})
+		assertErrorIs(t, err, nil)
+
+		_, err = models.Characters.GetBySlug(ctx, "axe")
+		assertErrorIs(t, err, nil)
+
+		// Errors from inside the transaction keep their type.
+		err = models.WithTx(ctx, func(tx data.Models) error {
+			return tx.Characters.Insert(ctx, &data.Character{Slug: "axe", Name: "Axe", Health: 700, MoveSpeed: 310, Mana: 250, Roles: []string{"Initiator"}})
+		})
+		assertErrorIs(t, err, data.ErrDuplicateSlug)
+	})
+}
+
+func TestMigrationsApplyToEmptySchema(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := migrations.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(latest) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(latest))
+	}
+
+	// Running again has nothing left to do.
+	applied, err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("applied %d migrations the second time, want none", len(applied))
+	}
+}
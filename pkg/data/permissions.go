@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
@@ -10,6 +9,9 @@ import (
 
 type Permissions []string
 
+// DefaultPermissions are granted to every newly registered user.
+var DefaultPermissions = Permissions{"characters:read", "players:read"}
+
 func (p Permissions) Include(code string) bool {
 	for i := range p {
 		if code == p[i] {
@@ -20,10 +22,11 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB Querier
+	Timeout time.Duration
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
 	SELECT permissions.code
 	FROM permissions
@@ -31,8 +34,10 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	INNER JOIN users ON users_permissions.user_id = users.id
 	WHERE users.id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "PermissionModel.GetAllForUser")
+	defer span.End()
 
 	rows, err := m.DB.QueryContext(ctx, query, userID)
 
@@ -56,14 +61,67 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
 	INSERT INTO users_permissions
 	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "PermissionModel.AddForUser")
+	defer span.End()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
-}
\ No newline at end of file
+	return translateError(err)
+}
+
+func (m PermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+	DELETE FROM users_permissions
+	USING permissions
+	WHERE users_permissions.permission_id = permissions.id
+	AND users_permissions.user_id = $1
+	AND permissions.code = ANY($2)`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "PermissionModel.RemoveForUser")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return translateError(err)
+}
+
+// GetAll returns every permission code which can be granted.
+func (m PermissionModel) GetAll(ctx context.Context) (Permissions, error) {
+	query := `
+	SELECT code
+	FROM permissions
+	ORDER BY code`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "PermissionModel.GetAll")
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
@@ -0,0 +1,64 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"slices"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		all, err := models.Permissions.GetAll(ctx)
+		assertErrorIs(t, err, nil)
+
+		want := data.Permissions{"admin:logging", "characters:read", "characters:write", "players:read", "players:write"}
+		if !slices.Equal(all, want) {
+			t.Fatalf("got permissions %v, want %v", all, want)
+		}
+
+		alice := insertTestUser(t, models, "alice@example.com")
+		bob := insertTestUser(t, models, "bob@example.com")
+
+		permissions, err := models.Permissions.GetAllForUser(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if len(permissions) != 0 {
+			t.Fatalf("got permissions %v for a new user, want none", permissions)
+		}
+
+		// Unknown codes are ignored.
+		err = models.Permissions.AddForUser(ctx, alice.ID, "players:write", "characters:read", "unknown:code")
+		assertErrorIs(t, err, nil)
+
+		err = models.Permissions.AddForUser(ctx, bob.ID, data.DefaultPermissions...)
+		assertErrorIs(t, err, nil)
+
+		err = models.Permissions.AddForUser(ctx, alice.ID, "characters:read")
+		assertConstraint(t, err, data.ConstraintUnique, "users_permissions_pkey")
+
+		permissions, err = models.Permissions.GetAllForUser(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		slices.Sort(permissions)
+		if want := (data.Permissions{"characters:read", "players:write"}); !slices.Equal(permissions, want) {
+			t.Fatalf("got permissions %v, want %v", permissions, want)
+		}
+
+		err = models.Permissions.RemoveForUser(ctx, alice.ID, "characters:read", "characters:write")
+		assertErrorIs(t, err, nil)
+
+		permissions, err = models.Permissions.GetAllForUser(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if want := (data.Permissions{"players:write"}); !slices.Equal(permissions, want) {
+			t.Fatalf("got permissions %v after removing, want %v", permissions, want)
+		}
+
+		permissions, err = models.Permissions.GetAllForUser(ctx, bob.ID)
+		assertErrorIs(t, err, nil)
+		slices.Sort(permissions)
+		if !slices.Equal(permissions, data.DefaultPermissions) {
+			t.Fatalf("got permissions %v for bob, want %v", permissions, data.DefaultPermissions)
+		}
+	})
+}
@@ -35,11 +35,12 @@ func ValidatePlayer(v *validator.Validator, player *Player) {
 	v.Check(validator.Unique(player.Roles), "Roles", "must not contain duplicate values")
 }
 
-type MockPlayerModel struct {
-	DB *sql.DB
+type PlayerModel struct {
+	DB Querier
+	Timeout time.Duration
 }
 
-func (p MockPlayerModel) Insert(player *Player) error {
+func (p PlayerModel) Insert(ctx context.Context, player *Player) error {
 	query := `
 			INSERT INTO players (nicknames, mmr, winrate, totalmatches,roles)
 			VALUES ($1, $2, $3, $4, $5)
@@ -47,12 +48,15 @@ func (p MockPlayerModel) Insert(player *Player) error {
 	
 	args := []interface{}{player.Nickname, player.MMR, player.WinRate,player.TotalMatches, pq.Array(player.Roles)}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, p.Timeout)
 	defer cancel()
-	return p.DB.QueryRowContext(ctx,query, args...).Scan(&player.PlayerID, &player.CreatedAt)
+	ctx, span := startSpan(ctx, "PlayerModel.Insert")
+	defer span.End()
+	err := p.DB.QueryRowContext(ctx,query, args...).Scan(&player.PlayerID, &player.CreatedAt)
+	return translateError(err)
 }
 
-func (p MockPlayerModel) Get(playerid int64) (*Player, error) {
+func (p PlayerModel) Get(ctx context.Context, playerid int64) (*Player, error) {
 	if playerid < 1 {
 		return nil, ErrRecordNotFound
 	}
@@ -64,9 +68,11 @@ func (p MockPlayerModel) Get(playerid int64) (*Player, error) {
 
 	var player Player
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, p.Timeout)
 
 	defer cancel()
+	ctx, span := startSpan(ctx, "PlayerModel.Get")
+	defer span.End()
 
 	err := p.DB.QueryRowContext(ctx,query, playerid).Scan(
 		&player.PlayerID,
@@ -90,7 +96,45 @@ func (p MockPlayerModel) Get(playerid int64) (*Player, error) {
 	return &player, nil
 }
 
-func (p MockPlayerModel) Update(player *Player) error {
+// GetByNickname finds a player by nickname, ignoring case.
+func (p PlayerModel) GetByNickname(ctx context.Context, nickname string) (*Player, error) {
+	query := `
+		SELECT playerid, created_at, nicknames, mmr, winrate, totalmatches ,roles
+		FROM players
+		WHERE lower(nicknames) = lower($1)
+		ORDER BY playerid
+		LIMIT 1`
+
+	var player Player
+
+	ctx, cancel := withQueryTimeout(ctx, p.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "PlayerModel.GetByNickname")
+	defer span.End()
+
+	err := p.DB.QueryRowContext(ctx, query, nickname).Scan(
+		&player.PlayerID,
+		&player.CreatedAt,
+		&player.Nickname,
+		&player.MMR,
+		&player.WinRate,
+		&player.TotalMatches,
+		pq.Array(&player.Roles),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &player, nil
+}
+
+func (p PlayerModel) Update(ctx context.Context, player *Player) error {
 	query := `
 	UPDATE players
 	SET nicknames = $1, mmr = $2, winrate = $3, totalmatches = $4, roles=$5
@@ -106,8 +150,10 @@ func (p MockPlayerModel) Update(player *Player) error {
 		player.PlayerID,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, p.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "PlayerModel.Update")
+	defer span.End()
 
 	err := p.DB.QueryRowContext(ctx,query, args...).Scan(
 		&player.PlayerID,
@@ -124,13 +170,13 @@ func (p MockPlayerModel) Update(player *Player) error {
 			case errors.Is(err, sql.ErrNoRows):
 				return ErrEditConflict
 			default:
-				return err
+				return translateError(err)
 		}
 	}
 	return nil
 }
 
-func (p MockPlayerModel) Delete(playerid int64) error {
+func (p PlayerModel) Delete(ctx context.Context, playerid int64) error {
 	if playerid < 1 {
 		return ErrRecordNotFound
 	}
@@ -139,8 +185,10 @@ func (p MockPlayerModel) Delete(playerid int64) error {
 	DELETE FROM players
 	WHERE playerid = $1`
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, p.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "PlayerModel.Delete")
+	defer span.End()
 
 	result, err := p.DB.ExecContext(ctx,query, playerid)
 	if err != nil {
@@ -159,7 +207,7 @@ func (p MockPlayerModel) Delete(playerid int64) error {
 	return nil
 }
 
-func (p MockPlayerModel) GetAll(Nickname string, Roles []string, filters Filters) ([]*Player,Metadata,error) {
+func (p PlayerModel) GetAll(ctx context.Context, Nickname string, Roles []string, filters Filters) ([]*Player,Metadata,error) {
 	query :=  fmt.Sprintf(`
 		SELECT count(*) OVER(), playerid, created_at, nicknames, mmr, winrate, totalmatches, roles
 		FROM players
@@ -168,8 +216,10 @@ func (p MockPlayerModel) GetAll(Nickname string, Roles []string, filters Filters
 		ORDER BY %s %s, playerid ASC 
 		LIMIT $3 OFFSET $4`,filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, p.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "PlayerModel.GetAll")
+	defer span.End()
 
 	args := []interface{}{Nickname, pq.Array(Roles), filters.limit(), filters.offset()}
 
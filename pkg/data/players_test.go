@@ -0,0 +1,174 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"slices"
+	"testing"
+)
+
+var playerSortSafelist = []string{"playerid", "nicknames", "mmr", "winrate", "totalmatches", "-playerid", "-nicknames", "-mmr", "-winrate", "-totalmatches"}
+
+func insertTestPlayer(t *testing.T, models data.Models, nickname string, mmr int32, roles ...string) *data.Player {
+	t.Helper()
+
+	player := &data.Player{Nickname: nickname, MMR: mmr, WinRate: 55, TotalMatches: 1000, Roles: roles}
+
+	err := models.Players.Insert(context.Background(), player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return player
+}
+
+func TestPlayerCRUD(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		miracle := insertTestPlayer(t, models, "Miracle", 9000, "Carry", "Mid")
+		if miracle.PlayerID < 1 || miracle.CreatedAt.IsZero() {
+			t.Fatalf("got player %+v, want an id and creation time", miracle)
+		}
+
+		got, err := models.Players.Get(ctx, miracle.PlayerID)
+		assertErrorIs(t, err, nil)
+		if got.Nickname != "Miracle" || got.MMR != 9000 || got.WinRate != 55 || got.TotalMatches != 1000 || !slices.Equal(got.Roles, miracle.Roles) {
+			t.Fatalf("got player %+v, want %+v", got, miracle)
+		}
+
+		for _, id := range []int64{0, -1, miracle.PlayerID + 100} {
+			_, err = models.Players.Get(ctx, id)
+			assertErrorIs(t, err, data.ErrRecordNotFound)
+		}
+
+		// Nicknames aren't unique, so the oldest player wins.
+		insertTestPlayer(t, models, "MIRACLE", 3000, "Support")
+
+		got, err = models.Players.GetByNickname(ctx, "miracle")
+		assertErrorIs(t, err, nil)
+		if got.PlayerID != miracle.PlayerID {
+			t.Fatalf("got player %d by nickname, want %d", got.PlayerID, miracle.PlayerID)
+		}
+
+		_, err = models.Players.GetByNickname(ctx, "Puppey")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		got.MMR = 9500
+		got.TotalMatches = 1001
+		got.Roles = []string{"Carry"}
+		err = models.Players.Update(ctx, got)
+		assertErrorIs(t, err, nil)
+
+		got, err = models.Players.Get(ctx, miracle.PlayerID)
+		assertErrorIs(t, err, nil)
+		if got.MMR != 9500 || got.TotalMatches != 1001 || !slices.Equal(got.Roles, []string{"Carry"}) || !got.CreatedAt.Equal(miracle.CreatedAt) {
+			t.Fatalf("got updated player %+v", got)
+		}
+
+		err = models.Players.Update(ctx, &data.Player{PlayerID: miracle.PlayerID + 100, Nickname: "Gone", MMR: 1, WinRate: 1, Roles: []string{"Carry"}})
+		assertErrorIs(t, err, data.ErrEditConflict)
+
+		err = models.Players.Delete(ctx, miracle.PlayerID)
+		assertErrorIs(t, err, nil)
+
+		_, err = models.Players.Get(ctx, miracle.PlayerID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.Players.Delete(ctx, miracle.PlayerID)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		err = models.Players.Delete(ctx, 0)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+	})
+}
+
+func TestPlayerGetAll(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		insertTestPlayer(t, models, "Miracle", 9000, "Carry", "Mid")
+		insertTestPlayer(t, models, "N0tail", 7000, "Support")
+		insertTestPlayer(t, models, "Puppey", 8000, "Support", "Captain")
+		insertTestPlayer(t, models, "Topson", 8000, "Mid")
+
+		tests := []struct {
+			name          string
+			search        string
+			roles         []string
+			filters       data.Filters
+			wantNicknames []string
+			wantMetadata  data.Metadata
+		}{
+			{
+				name:          "all",
+				filters:       data.Filters{Page: 1, PageSize: 20, Sort: "playerid"},
+				wantNicknames: []string{"Miracle", "N0tail", "Puppey", "Topson"},
+				wantMetadata:  data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 4},
+			},
+			{
+				name:          "full-text search ignores case",
+				search:        "PUPPEY",
+				filters:       data.Filters{Page: 1, PageSize: 20, Sort: "playerid"},
+				wantNicknames: []string{"Puppey"},
+				wantMetadata:  data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			{
+				name:          "one role",
+				roles:         []string{"Mid"},
+				filters:       data.Filters{Page: 1, PageSize: 20, Sort: "playerid"},
+				wantNicknames: []string{"Miracle", "Topson"},
+				wantMetadata:  data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+			},
+			{
+				name:          "every role",
+				roles:         []string{"Support", "Captain"},
+				filters:       data.Filters{Page: 1, PageSize: 20, Sort: "playerid"},
+				wantNicknames: []string{"Puppey"},
+				wantMetadata:  data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			{
+				name:          "unknown role",
+				roles:         []string{"Coach"},
+				filters:       data.Filters{Page: 1, PageSize: 20, Sort: "playerid"},
+				wantNicknames: []string{},
+				wantMetadata:  data.Metadata{},
+			},
+			{
+				name:          "sort by mmr descending, ties by id",
+				filters:       data.Filters{Page: 1, PageSize: 20, Sort: "-mmr"},
+				wantNicknames: []string{"Miracle", "Puppey", "Topson", "N0tail"},
+				wantMetadata:  data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 4},
+			},
+			{
+				name:          "second page",
+				filters:       data.Filters{Page: 2, PageSize: 3, Sort: "mmr"},
+				wantNicknames: []string{"Miracle"},
+				wantMetadata:  data.Metadata{CurrentPage: 2, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 4},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.filters.SortSafelist = playerSortSafelist
+
+				if tt.roles == nil {
+					tt.roles = []string{}
+				}
+
+				players, metadata, err := models.Players.GetAll(context.Background(), tt.search, tt.roles, tt.filters)
+				assertErrorIs(t, err, nil)
+
+				nicknames := []string{}
+				for _, player := range players {
+					nicknames = append(nicknames, player.Nickname)
+				}
+
+				if !slices.Equal(nicknames, tt.wantNicknames) {
+					t.Errorf("got %v, want %v", nicknames, tt.wantNicknames)
+				}
+				if metadata != tt.wantMetadata {
+					t.Errorf("got metadata %+v, want %+v", metadata, tt.wantMetadata)
+				}
+			})
+		}
+	})
+}
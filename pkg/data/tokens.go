@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"errors"
 	"time"
 	"database/sql"
 	"goproject/pkg/validator"
@@ -14,6 +15,14 @@ const (
 	ScopeActivation = "activation"
 	ScopeAuthentication = "authentication" 
 	ScopePasswordReset = "password-reset"
+	ScopeRefresh = "refresh"
+	ScopeAPIKey = "api-key"
+	ScopeMFAChallenge = "mfa-challenge"
+	ScopeUnlock = "unlock"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reused")
 )
 
 type Token struct {
@@ -22,6 +31,7 @@ type Token struct {
 	UserID int64 `json:"-"`
 	Expiry time.Time `json:"expiry"`
 	Scope string `json:"-"`
+	Family string `json:"-"`
 }	
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -46,49 +56,177 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
+// generateFamily returns a random identifier shared by every access and
+// refresh token descended from a single login.
+func generateFamily() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB Querier
+	Timeout time.Duration
 }
 
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 	return token, err
 }
 
+// NewForFamily creates a token which belongs to the given family, starting a
+// new family when it is empty.
+func (m TokenModel) NewForFamily(ctx context.Context, userID int64, ttl time.Duration, scope, family string) (*Token, error) {
+	if family == "" {
+		var err error
+		family, err = generateFamily()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-func (m TokenModel) Insert(token *Token) error {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Family = family
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+// NewPair issues a short-lived authentication token together with a refresh
+// token. An empty family starts a new token family, otherwise the pair joins
+// the given one.
+func (m TokenModel) NewPair(ctx context.Context, userID int64, accessTTL, refreshTTL time.Duration, family string) (*Token, *Token, error) {
+	refresh, err := m.NewForFamily(ctx, userID, refreshTTL, ScopeRefresh, family)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, err := m.NewForFamily(ctx, userID, accessTTL, ScopeAuthentication, refresh.Family)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, nil
+}
+
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
+	INSERT INTO tokens (hash, user_id, expiry, scope, family)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
 	
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
 	defer cancel()
+	ctx, span := startSpan(ctx, "TokenModel.Insert")
+	defer span.End()
 
 	_, err := m.DB.ExecContext(ctx, query, args...)
 
+	return translateError(err)
+}
+
+// UseRefresh marks a refresh token as used and returns it so that a new pair
+// can be issued in the same family. Presenting a token which has already been
+// used means it was leaked or replayed: the whole family is revoked and
+// ErrRefreshTokenReused is returned together with the offending token.
+func (m TokenModel) UseRefresh(ctx context.Context, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	UPDATE tokens
+	SET used = true
+	WHERE hash = $1 AND scope = $2 AND expiry > $3 AND NOT used
+	RETURNING user_id, expiry, family`
+
+	token := &Token{
+		Plaintext: tokenPlaintext,
+		Hash: tokenHash[:],
+		Scope: ScopeRefresh,
+	}
+
+	var family sql.NullString
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "TokenModel.UseRefresh")
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now()).Scan(&token.UserID, &token.Expiry, &family)
+	if err == nil {
+		token.Family = family.String
+		return token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	query = `
+	SELECT user_id, expiry, family
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND used`
+
+	err = m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh).Scan(&token.UserID, &token.Expiry, &family)
+	if err != nil {
+		switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, ErrRecordNotFound
+			default:
+				return nil, err
+		}
+	}
+	token.Family = family.String
+
+	err = m.DeleteFamily(ctx, token.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, ErrRefreshTokenReused
+}
+
+func (m TokenModel) DeleteFamily(ctx context.Context, family string) error {
+	query := `
+	DELETE FROM tokens
+	WHERE family = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "TokenModel.DeleteFamily")
+	defer span.End()
+
+	_, err := m.DB.ExecContext(ctx, query, family)
 	return err
 }
 	
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 	DELETE FROM tokens
 	WHERE scope = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, m.Timeout)
 
 	defer cancel()
+	ctx, span := startSpan(ctx, "TokenModel.DeleteAllForUser")
+	defer span.End()
 
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
-}
\ No newline at end of file
+}
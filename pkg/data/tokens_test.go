@@ -0,0 +1,137 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"testing"
+	"time"
+)
+
+func TestTokenPairAndRefresh(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+
+		access, refresh, err := models.Tokens.NewPair(ctx, alice.ID, time.Minute, time.Hour, "")
+		assertErrorIs(t, err, nil)
+		if access.Family == "" || access.Family != refresh.Family || access.Scope != data.ScopeAuthentication || refresh.Scope != data.ScopeRefresh {
+			t.Fatalf("got tokens %+v and %+v, want a pair in one new family", access, refresh)
+		}
+
+		used, err := models.Tokens.UseRefresh(ctx, refresh.Plaintext)
+		assertErrorIs(t, err, nil)
+		if used.UserID != alice.ID || used.Family != refresh.Family {
+			t.Fatalf("got refresh token %+v, want alice's in family %s", used, refresh.Family)
+		}
+
+		// The rotated pair joins the same family.
+		nextAccess, nextRefresh, err := models.Tokens.NewPair(ctx, alice.ID, time.Minute, time.Hour, used.Family)
+		assertErrorIs(t, err, nil)
+		if nextRefresh.Family != refresh.Family {
+			t.Fatalf("got family %s, want %s", nextRefresh.Family, refresh.Family)
+		}
+
+		// An unrelated login isn't affected by reuse in another family.
+		otherAccess, _, err := models.Tokens.NewPair(ctx, alice.ID, time.Minute, time.Hour, "")
+		assertErrorIs(t, err, nil)
+
+		reused, err := models.Tokens.UseRefresh(ctx, refresh.Plaintext)
+		assertErrorIs(t, err, data.ErrRefreshTokenReused)
+		if reused.UserID != alice.ID {
+			t.Fatalf("got reused token for user %d, want %d", reused.UserID, alice.ID)
+		}
+
+		for _, token := range []*data.Token{access, nextAccess} {
+			_, err = models.Users.GetForToken(ctx, data.ScopeAuthentication, token.Plaintext)
+			assertErrorIs(t, err, data.ErrRecordNotFound)
+		}
+
+		_, err = models.Tokens.UseRefresh(ctx, nextRefresh.Plaintext)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		_, err = models.Users.GetForToken(ctx, data.ScopeAuthentication, otherAccess.Plaintext)
+		assertErrorIs(t, err, nil)
+	})
+}
+
+func TestUseRefreshRejects(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+
+		access, _, err := models.Tokens.NewPair(ctx, alice.ID, time.Minute, time.Hour, "")
+		assertErrorIs(t, err, nil)
+
+		expired, err := models.Tokens.NewForFamily(ctx, alice.ID, -time.Hour, data.ScopeRefresh, "")
+		assertErrorIs(t, err, nil)
+
+		tests := []struct {
+			name      string
+			plaintext string
+		}{
+			{"unknown", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+			{"access token", access.Plaintext},
+			{"expired", expired.Plaintext},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := models.Tokens.UseRefresh(ctx, tt.plaintext)
+				assertErrorIs(t, err, data.ErrRecordNotFound)
+			})
+		}
+	})
+}
+
+func TestTokenDeletion(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+		bob := insertTestUser(t, models, "bob@example.com")
+
+		aliceAuth, err := models.Tokens.New(ctx, alice.ID, time.Hour, data.ScopeAuthentication)
+		assertErrorIs(t, err, nil)
+		aliceActivation, err := models.Tokens.New(ctx, alice.ID, time.Hour, data.ScopeActivation)
+		assertErrorIs(t, err, nil)
+		bobAuth, err := models.Tokens.New(ctx, bob.ID, time.Hour, data.ScopeAuthentication)
+		assertErrorIs(t, err, nil)
+
+		err = models.Tokens.DeleteAllForUser(ctx, data.ScopeAuthentication, alice.ID)
+		assertErrorIs(t, err, nil)
+
+		_, err = models.Users.GetForToken(ctx, data.ScopeAuthentication, aliceAuth.Plaintext)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+		_, err = models.Users.GetForToken(ctx, data.ScopeActivation, aliceActivation.Plaintext)
+		assertErrorIs(t, err, nil)
+		_, err = models.Users.GetForToken(ctx, data.ScopeAuthentication, bobAuth.Plaintext)
+		assertErrorIs(t, err, nil)
+
+		access, refresh, err := models.Tokens.NewPair(ctx, bob.ID, time.Minute, time.Hour, "")
+		assertErrorIs(t, err, nil)
+
+		err = models.Tokens.DeleteFamily(ctx, access.Family)
+		assertErrorIs(t, err, nil)
+
+		_, err = models.Users.GetForToken(ctx, data.ScopeAuthentication, access.Plaintext)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+		_, err = models.Tokens.UseRefresh(ctx, refresh.Plaintext)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		// Tokens outside any family are untouched by deleting the empty one.
+		err = models.Tokens.DeleteFamily(ctx, "")
+		assertErrorIs(t, err, nil)
+		_, err = models.Users.GetForToken(ctx, data.ScopeAuthentication, bobAuth.Plaintext)
+		assertErrorIs(t, err, nil)
+	})
+}
+
+func TestTokenForeignKey(t *testing.T) {
+	models := newPostgresModels(t)
+
+	// The in-memory models don't enforce foreign keys.
+	_, err := models.Tokens.New(context.Background(), 999, time.Hour, data.ScopeAuthentication)
+	assertConstraint(t, err, data.ConstraintForeignKey, "tokens_user_id_fkey")
+}
@@ -0,0 +1,137 @@
+package data_test
+
+import (
+	"context"
+	"goproject/pkg/data"
+	"testing"
+	"time"
+)
+
+func TestUserCRUD(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+		if alice.ID < 1 || alice.CreatedAt.IsZero() || alice.Version != 1 {
+			t.Fatalf("got user %+v, want an id, creation time and version 1", alice)
+		}
+
+		// Emails are unique whatever their case.
+		duplicate := &data.User{Name: "Alice Again", Email: "ALICE@example.com"}
+		err := duplicate.Password.Set(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = models.Users.Insert(ctx, duplicate)
+		assertErrorIs(t, err, data.ErrDuplicateEmail)
+		assertConstraint(t, err, data.ConstraintUnique, "users_email_key")
+
+		got, err := models.Users.Get(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if got.Email != "alice@example.com" || got.Name != "Test User" || !got.Activated || got.Version != 1 {
+			t.Fatalf("got user %+v, want %+v", got, alice)
+		}
+
+		match, err := got.Password.Matches(testPassword)
+		if err != nil || !match {
+			t.Fatalf("stored password doesn't match: %v", err)
+		}
+
+		got, err = models.Users.GetByEmail(ctx, "Alice@Example.COM")
+		assertErrorIs(t, err, nil)
+		if got.ID != alice.ID {
+			t.Fatalf("got user %d by email, want %d", got.ID, alice.ID)
+		}
+
+		_, err = models.Users.Get(ctx, 0)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+		_, err = models.Users.Get(ctx, alice.ID+100)
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+		_, err = models.Users.GetByEmail(ctx, "nobody@example.com")
+		assertErrorIs(t, err, data.ErrRecordNotFound)
+
+		bob := insertTestUser(t, models, "bob@example.com")
+
+		users, err := models.Users.GetAll(ctx)
+		assertErrorIs(t, err, nil)
+		if len(users) != 2 || users[0].ID != alice.ID || users[1].ID != bob.ID {
+			t.Fatalf("got users %+v, want alice then bob", users)
+		}
+
+		bob.Email = "ALICE@EXAMPLE.COM"
+		err = models.Users.Update(ctx, bob)
+		assertErrorIs(t, err, data.ErrDuplicateEmail)
+	})
+}
+
+func TestUserUpdateVersionConflict(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+
+		first, err := models.Users.Get(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		second, err := models.Users.Get(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+
+		first.Name = "Alice"
+		err = models.Users.Update(ctx, first)
+		assertErrorIs(t, err, nil)
+		if first.Version != 2 {
+			t.Fatalf("got version %d after update, want 2", first.Version)
+		}
+
+		// The second copy was read before the update, so saving it would
+		// undo the change.
+		second.Activated = false
+		err = models.Users.Update(ctx, second)
+		assertErrorIs(t, err, data.ErrEditConflict)
+
+		got, err := models.Users.Get(ctx, alice.ID)
+		assertErrorIs(t, err, nil)
+		if got.Name != "Alice" || !got.Activated || got.Version != 2 {
+			t.Fatalf("got user %+v after conflicting update", got)
+		}
+
+		err = models.Users.Update(ctx, &data.User{ID: alice.ID + 100, Name: "Gone", Email: "gone@example.com", Version: 1})
+		assertErrorIs(t, err, data.ErrEditConflict)
+	})
+}
+
+func TestUserGetForToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, models data.Models) {
+		ctx := context.Background()
+
+		alice := insertTestUser(t, models, "alice@example.com")
+
+		token, err := models.Tokens.New(ctx, alice.ID, time.Hour, data.ScopeAuthentication)
+		assertErrorIs(t, err, nil)
+
+		expired, err := models.Tokens.New(ctx, alice.ID, -time.Hour, data.ScopeAuthentication)
+		assertErrorIs(t, err, nil)
+
+		tests := []struct {
+			name      string
+			scope     string
+			plaintext string
+			want      error
+		}{
+			{"valid", data.ScopeAuthentication, token.Plaintext, nil},
+			{"wrong scope", data.ScopeActivation, token.Plaintext, data.ErrRecordNotFound},
+			{"expired", data.ScopeAuthentication, expired.Plaintext, data.ErrRecordNotFound},
+			{"unknown", data.ScopeAuthentication, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", data.ErrRecordNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				user, err := models.Users.GetForToken(ctx, tt.scope, tt.plaintext)
+				assertErrorIs(t, err, tt.want)
+
+				if tt.want == nil && user.ID != alice.ID {
+					t.Fatalf("got user %d, want %d", user.ID, alice.ID)
+				}
+			})
+		}
+	})
+}
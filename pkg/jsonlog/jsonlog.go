@@ -2,78 +2,147 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota 
-	LevelError 
-	LevelFatal 
-	LevelOff 
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+	LevelOff
 )
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// output is shared by a logger and all of its children, so changing the level
+// on any of them affects them all.
+type output struct {
+	out      io.Writer
+	minLevel atomic.Int32
+	traces   atomic.Bool
+	mu       sync.Mutex
+}
+
 type Logger struct {
-	out io.Writer
-	minLevel Level
-	mu sync.Mutex
+	output *output
+	fields map[string]interface{}
 }
 
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out: out,
-		minLevel: minLevel,
+	o := &output{out: out}
+	o.minLevel.Store(int32(minLevel))
+
+	return &Logger{output: o}
+}
+
+// With returns a child logger which adds properties to every line it writes.
+func (l *Logger) With(properties map[string]interface{}) *Logger {
+	fields := make(map[string]interface{}, len(l.fields)+len(properties))
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range properties {
+		fields[k] = v
 	}
+
+	return &Logger{output: l.output, fields: fields}
+}
+
+func (l *Logger) Level() Level {
+	return Level(l.output.minLevel.Load())
+}
+
+// SetLevel changes the minimum level written, and is safe to call while the
+// logger is in use.
+func (l *Logger) SetLevel(level Level) {
+	l.output.minLevel.Store(int32(level))
+}
+
+// SetStackTraces controls whether ERROR and FATAL lines include a stack trace.
+func (l *Logger) SetStackTraces(enabled bool) {
+	l.output.traces.Store(enabled)
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level() && level < LevelOff
 }
 
-func (l *Logger) PrintInfo(message string, properties map[string]string) {
+func (l *Logger) PrintDebug(message string, properties map[string]interface{}) {
+	l.print(LevelDebug, message, properties)
+}
+func (l *Logger) PrintInfo(message string, properties map[string]interface{}) {
 	l.print(LevelInfo, message, properties)
 }
-func (l *Logger) PrintError(err error, properties map[string]string) {
+func (l *Logger) PrintWarn(message string, properties map[string]interface{}) {
+	l.print(LevelWarn, message, properties)
+}
+func (l *Logger) PrintError(err error, properties map[string]interface{}) {
 	l.print(LevelError, err.Error(), properties)
 }
-func (l *Logger) PrintFatal(err error, properties map[string]string) {
+func (l *Logger) PrintFatal(err error, properties map[string]interface{}) {
 	l.print(LevelFatal, err.Error(), properties)
-	os.Exit(1) 
+	os.Exit(1)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+func (l *Logger) print(level Level, message string, properties map[string]interface{}) (int, error) {
+	if !l.Enabled(level) {
 		return 0, nil
 	}
+
 	aux := struct {
-		Level string `json:"level"`
-		Time string `json:"time"`
-		Message string `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace string `json:"trace,omitempty"`
+		Level      string                 `json:"level"`
+		Time       string                 `json:"time"`
+		Message    string                 `json:"message"`
+		Properties map[string]interface{} `json:"properties,omitempty"`
+		Trace      string                 `json:"trace,omitempty"`
 	}{
-		Level: level.String(),
-		Time: time.Now().UTC().Format(time.RFC3339),
-		Message: message,
-		Properties: properties,
+		Level:      level.String(),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Message:    message,
+		Properties: l.merge(properties),
 	}
 
-	if level >= LevelError {
-	aux.Trace = string(debug.Stack())
+	if level >= LevelError && l.output.traces.Load() {
+		aux.Trace = string(debug.Stack())
 	}
 
 	var line []byte
@@ -82,14 +151,63 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 	if err != nil {
 		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
 	}
-	
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	
-	return l.out.Write(append(line, '\n'))
+
+	l.output.mu.Lock()
+	defer l.output.mu.Unlock()
+
+	return l.output.out.Write(append(line, '\n'))
+}
+
+// merge combines the logger's bound fields with properties, converting values
+// which don't marshal usefully by themselves.
+func (l *Logger) merge(properties map[string]interface{}) map[string]interface{} {
+	if len(l.fields) == 0 && len(properties) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]interface{}, len(l.fields)+len(properties))
+	for k, v := range l.fields {
+		merged[k] = value(v)
+	}
+	for k, v := range properties {
+		merged[k] = value(v)
+	}
+
+	return merged
+}
+
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.String()
+	case error:
+		if isNil(v) {
+			return "<nil>"
+		}
+		return v.Error()
+	case fmt.Stringer:
+		if isNil(v) {
+			return "<nil>"
+		}
+		return v.String()
+	case map[string]interface{}:
+		nested := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			nested[k] = value(x)
+		}
+		return nested
+	default:
+		return v
+	}
+}
+
+// isNil reports whether v holds a nil pointer, such as a nil *pq.Error in an
+// error interface, whose methods would panic if called.
+func isNil(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
 }
 
 func (l *Logger) Write(message []byte) (n int, err error) {
 	return l.print(LevelError, string(message), nil)
 }
-	
\ No newline at end of file
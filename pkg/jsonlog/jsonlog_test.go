@@ -0,0 +1,233 @@
+package jsonlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goproject/pkg/jsonlog"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type line struct {
+	Level      string                 `json:"level"`
+	Time       string                 `json:"time"`
+	Message    string                 `json:"message"`
+	Properties map[string]interface{} `json:"properties"`
+	Trace      string                 `json:"trace"`
+}
+
+func readLines(t *testing.T, buf *bytes.Buffer) []line {
+	t.Helper()
+
+	var lines []line
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if raw == "" {
+			continue
+		}
+
+		var l line
+		err := json.Unmarshal([]byte(raw), &l)
+		if err != nil {
+			t.Fatalf("%q isn't JSON: %v", raw, err)
+		}
+		lines = append(lines, l)
+	}
+	buf.Reset()
+
+	return lines
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want jsonlog.Level
+	}{
+		{"debug", jsonlog.LevelDebug},
+		{"INFO", jsonlog.LevelInfo},
+		{"Warn", jsonlog.LevelWarn},
+		{"error", jsonlog.LevelError},
+		{"fatal", jsonlog.LevelFatal},
+		{"off", jsonlog.LevelOff},
+	} {
+		got, err := jsonlog.ParseLevel(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %s, %v, want %s", tt.s, got, err, tt.want)
+		}
+	}
+
+	_, err := jsonlog.ParseLevel("verbose")
+	if err == nil {
+		t.Error("got no error for an unknown level")
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelWarn)
+	child := logger.With(map[string]interface{}{"component": "test"})
+
+	logAll := func(l *jsonlog.Logger) {
+		l.PrintDebug("debug", nil)
+		l.PrintInfo("info", nil)
+		l.PrintWarn("warn", nil)
+		l.PrintError(errors.New("error"), nil)
+	}
+
+	logAll(logger)
+
+	lines := readLines(t, &buf)
+	if len(lines) != 2 || lines[0].Level != "WARN" || lines[1].Level != "ERROR" || lines[1].Message != "error" {
+		t.Fatalf("got %+v, want the WARN and ERROR lines", lines)
+	}
+
+	// The level is shared with child loggers.
+	child.SetLevel(jsonlog.LevelDebug)
+	logAll(logger)
+
+	if lines := readLines(t, &buf); len(lines) != 4 {
+		t.Errorf("got %d lines at debug, want 4", len(lines))
+	}
+
+	logger.SetLevel(jsonlog.LevelOff)
+	logAll(child)
+
+	if buf.Len() != 0 {
+		t.Errorf("got %q with logging off", buf.String())
+	}
+	if child.Enabled(jsonlog.LevelFatal) {
+		t.Error("fatal is enabled with logging off")
+	}
+}
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	child := logger.With(map[string]interface{}{"request_id": "abc", "user_id": 1})
+	grandchild := child.With(map[string]interface{}{"user_id": 2})
+
+	grandchild.PrintInfo("request", map[string]interface{}{"status": 200})
+	child.PrintInfo("request", map[string]interface{}{"request_id": "overridden"})
+	logger.PrintInfo("plain", nil)
+
+	lines := readLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+
+	if p := lines[0].Properties; p["request_id"] != "abc" || p["user_id"] != float64(2) || p["status"] != float64(200) {
+		t.Errorf("got properties %v from the grandchild", p)
+	}
+	if p := lines[1].Properties; p["request_id"] != "overridden" || p["user_id"] != float64(1) {
+		t.Errorf("got properties %v from the child, want the line's own request_id", p)
+	}
+	if lines[2].Properties != nil {
+		t.Errorf("got properties %v from the parent, want none", lines[2].Properties)
+	}
+}
+
+type level int
+
+func (l level) String() string { return fmt.Sprintf("level-%d", l) }
+
+type point struct{ x, y int }
+
+func (p *point) String() string { return fmt.Sprintf("(%d, %d)", p.x, p.y) }
+
+func TestTypedValues(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	var nilErr *json.SyntaxError
+	var nilStringer *point
+
+	logger.PrintInfo("values", map[string]interface{}{
+		"duration":     1500 * time.Millisecond,
+		"error":        errors.New("boom"),
+		"stringer":     level(3),
+		"nil_error":    error(nilErr),
+		"nil_stringer": nilStringer,
+		"nested":       map[string]interface{}{"duration": time.Second},
+	})
+
+	p := readLines(t, &buf)[0].Properties
+
+	want := map[string]interface{}{
+		"duration":     "1.5s",
+		"error":        "boom",
+		"stringer":     "level-3",
+		"nil_error":    "<nil>",
+		"nil_stringer": "<nil>",
+	}
+	for k, v := range want {
+		if p[k] != v {
+			t.Errorf("got %s %v, want %v", k, p[k], v)
+		}
+	}
+
+	if nested, _ := p["nested"].(map[string]interface{}); nested["duration"] != "1s" {
+		t.Errorf("got nested %v", p["nested"])
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	logger.PrintError(errors.New("without"), nil)
+	logger.SetStackTraces(true)
+	logger.PrintWarn("warning", nil)
+	logger.PrintError(errors.New("with"), nil)
+
+	lines := readLines(t, &buf)
+	if lines[0].Trace != "" || lines[1].Trace != "" {
+		t.Error("got a trace without stack traces enabled, or below ERROR")
+	}
+	if !strings.Contains(lines[2].Trace, "TestStackTraces") {
+		t.Errorf("got trace %q, want the caller's stack", lines[2].Trace)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	_, err := logger.Write([]byte("http: TLS handshake error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readLines(t, &buf)
+	if lines[0].Level != "ERROR" || lines[0].Message != "http: TLS handshake error" {
+		t.Errorf("got %+v", lines[0])
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	log := slog.New(logger.Handler()).With("service", "api").WithGroup("http")
+
+	log.Debug("dropped")
+	log.Warn("slow request", "route", "/v1/characters", slog.Group("timing", "ms", 120))
+
+	lines := readLines(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want only the warning", len(lines))
+	}
+	if lines[0].Level != "WARN" || lines[0].Message != "slow request" {
+		t.Errorf("got %+v", lines[0])
+	}
+
+	p := lines[0].Properties
+	http, _ := p["http"].(map[string]interface{})
+	timing, _ := http["timing"].(map[string]interface{})
+	if p["service"] != "api" || http["route"] != "/v1/characters" || timing["ms"] != float64(120) {
+		t.Errorf("got properties %v", p)
+	}
+}
@@ -0,0 +1,99 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler returns a slog.Handler which writes through l, so code using
+// log/slog ends up in the same log stream.
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+type slogHandler struct {
+	logger *Logger
+	groups []string
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(_ context.Context, record slog.Record) error {
+	properties := make(map[string]interface{}, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(properties, attr)
+		return true
+	})
+
+	_, err := h.logger.print(fromSlogLevel(record.Level), record.Message, h.nest(properties))
+	return err
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	properties := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		addAttr(properties, attr)
+	}
+
+	return &slogHandler{logger: h.logger.With(h.nest(properties)), groups: h.groups}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	groups := append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &slogHandler{logger: h.logger, groups: groups}
+}
+
+// nest places properties inside the handler's open groups.
+func (h *slogHandler) nest(properties map[string]interface{}) map[string]interface{} {
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		if len(properties) == 0 {
+			return nil
+		}
+		properties = map[string]interface{}{h.groups[i]: properties}
+	}
+	return properties
+}
+
+func addAttr(properties map[string]interface{}, attr slog.Attr) {
+	v := attr.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		group := make(map[string]interface{})
+		for _, a := range v.Group() {
+			addAttr(group, a)
+		}
+		if attr.Key == "" {
+			for k, x := range group {
+				properties[k] = x
+			}
+			return
+		}
+		properties[attr.Key] = group
+		return
+	}
+
+	if attr.Key == "" {
+		return
+	}
+
+	properties[attr.Key] = v.Any()
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    key text PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp with time zone
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    event text NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    ip text NOT NULL DEFAULT '',
+    details jsonb NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS audit_events_user_id_idx ON audit_events (user_id);
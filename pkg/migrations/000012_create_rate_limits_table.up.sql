@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key text PRIMARY KEY,
+    tat timestamp with time zone NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE characters DROP CONSTRAINT IF EXISTS characters_slug_key;
+ALTER TABLE characters DROP COLUMN IF EXISTS slug;
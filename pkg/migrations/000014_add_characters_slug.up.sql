@@ -0,0 +1,18 @@
+-- citext keeps slugs unique regardless of case, even for rows written
+-- without going through Slugify.
+ALTER TABLE characters ADD COLUMN IF NOT EXISTS slug citext;
+
+UPDATE characters
+SET slug = trim(both '-' from regexp_replace(lower(replace(names, '''', '')), '[^a-z0-9]+', '-', 'g'))
+WHERE slug IS NULL;
+
+UPDATE characters SET slug = id::text WHERE slug = '';
+
+-- Existing characters with the same name keep the slug on the oldest row.
+UPDATE characters
+SET slug = characters.slug || '-' || characters.id
+FROM (SELECT slug, min(id) AS keep FROM characters GROUP BY slug HAVING count(*) > 1) AS duplicates
+WHERE characters.slug = duplicates.slug AND characters.id <> duplicates.keep;
+
+ALTER TABLE characters ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE characters ADD CONSTRAINT characters_slug_key UNIQUE (slug);
@@ -0,0 +1,228 @@
+// Package migrations embeds the SQL migrations and applies them, so the
+// binary knows which schema version it was built for and can bring a
+// database up to it.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+var (
+	ErrDirty            = errors.New("a migration failed part way through and the schema needs fixing by hand")
+	ErrChecksumMismatch = errors.New("an applied migration has been modified")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+// lockID identifies the advisory lock held while migrating, so replicas
+// started together don't apply the same migration twice.
+const lockID = 7170621000042
+
+// Migration is a pair of up and down files, such as
+// 000001_create_characters_table.up.sql.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Applied describes a migration recorded in the schema_migrations table.
+type Applied struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Load reads the embedded migrations in version order.
+func Load() ([]Migration, error) {
+	return load(FS)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".sql")
+		if !ok {
+			continue
+		}
+
+		prefix, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		switch {
+		case strings.HasSuffix(rest, ".up"):
+			m.Name = strings.TrimSuffix(rest, ".up")
+			m.Up = string(b)
+			sum := sha256.Sum256(b)
+			m.Checksum = hex.EncodeToString(sum[:])
+		case strings.HasSuffix(rest, ".down"):
+			m.Down = string(b)
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the number of the newest migration, which is the schema
+// version this build expects.
+func Latest() (int, error) {
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Version reads the schema version recorded in the database, and whether a
+// migration failed part way through. Only a schema_migrations table left by
+// golang-migrate, which hasn't been converted yet, can be dirty.
+func Version(ctx context.Context, db *sql.DB) (int, bool, error) {
+	layout, err := tableLayout(ctx, db)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch layout {
+	case layoutMissing:
+		return 0, false, nil
+	case layoutLegacy:
+		return legacyVersion(ctx, db)
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return version, false, nil
+}
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+const (
+	layoutMissing = iota
+	layoutLegacy
+	layoutCurrent
+)
+
+// tableLayout tells a golang-migrate schema_migrations table, which has a
+// single (version, dirty) row, from ours, which has a row per migration.
+func tableLayout(ctx context.Context, q queryer) (int, error) {
+	query := `
+	SELECT column_name
+	FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return 0, err
+		}
+		columns[column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case len(columns) == 0:
+		return layoutMissing, nil
+	case columns["checksum"]:
+		return layoutCurrent, nil
+	default:
+		return layoutLegacy, nil
+	}
+}
+
+func legacyVersion(ctx context.Context, q queryer) (int, bool, error) {
+	query := `
+	SELECT version, dirty
+	FROM schema_migrations
+	LIMIT 1`
+
+	var (
+		version int
+		dirty   bool
+	)
+
+	err := q.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
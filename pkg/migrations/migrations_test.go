@@ -0,0 +1,323 @@
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/lib/pq"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"000001_create_widgets.up.sql":    {Data: []byte(`CREATE TABLE widgets (id bigserial PRIMARY KEY)`)},
+		"000001_create_widgets.down.sql":  {Data: []byte(`DROP TABLE widgets`)},
+		"000002_add_widget_name.up.sql":   {Data: []byte(`ALTER TABLE widgets ADD COLUMN name text`)},
+		"000002_add_widget_name.down.sql": {Data: []byte(`ALTER TABLE widgets DROP COLUMN name`)},
+		"000010_create_gadgets.up.sql":    {Data: []byte(`CREATE TABLE gadgets (id bigserial PRIMARY KEY)`)},
+		"000010_create_gadgets.down.sql":  {Data: []byte(`DROP TABLE gadgets`)},
+		"README.md":                       {Data: []byte(`not a migration`)},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := load(testFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 3 {
+		t.Fatalf("got %d migrations, want 3", len(migrations))
+	}
+
+	for i, want := range []struct {
+		version int
+		name    string
+	}{{1, "create_widgets"}, {2, "add_widget_name"}, {10, "create_gadgets"}} {
+		m := migrations[i]
+		if m.Version != want.version || m.Name != want.name || m.Up == "" || m.Down == "" || len(m.Checksum) != 64 {
+			t.Errorf("migration %d: got %+v", i, m)
+		}
+	}
+
+	// The checksum covers the up file only.
+	fsys := testFS()
+	fsys["000001_create_widgets.down.sql"] = &fstest.MapFile{Data: []byte(`DROP TABLE IF EXISTS widgets`)}
+	changed, err := load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed[0].Checksum != migrations[0].Checksum {
+		t.Error("changing the down file changed the checksum")
+	}
+
+	fsys["000001_create_widgets.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE widgets (id serial PRIMARY KEY)`)}
+	changed, err = load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed[0].Checksum == migrations[0].Checksum {
+		t.Error("changing the up file kept the checksum")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"no version", "create_widgets.up.sql"},
+		{"bad version", "0x01_create_widgets.up.sql"},
+		{"no direction", "000003_create_widgets.sql"},
+		{"down without up", "000003_create_widgets.down.sql"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(fstest.MapFS{tt.file: {Data: []byte(`SELECT 1`)}})
+			if err == nil {
+				t.Errorf("got no error for %s", tt.file)
+			}
+		})
+	}
+}
+
+// TestEmbedded checks the migrations shipped in the binary load, so a badly
+// named file fails here rather than at startup.
+func TestEmbedded(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want versions numbered from 1 without gaps", i, m.Version)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d has no down file", m.Version)
+		}
+	}
+	if latest != len(migrations) {
+		t.Errorf("got latest version %d, want %d", latest, len(migrations))
+	}
+}
+
+// testDSNEnv names the variable holding the DSN of a PostgreSQL database the
+// tests may create schemas in. Tests which need a database are skipped
+// without it.
+const testDSNEnv = "TEST_DB_DSN"
+
+// openTestDB connects to a new, empty schema which is dropped when the test
+// finishes. The pool is limited to one connection so every statement sees
+// the same search_path.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	ctx := context.Background()
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	err = admin.PingContext(ctx)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+
+	b := make([]byte, 8)
+	_, err = rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(b)
+
+	_, err = admin.ExecContext(ctx, `CREATE SCHEMA `+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := admin.ExecContext(context.Background(), `DROP SCHEMA `+schema+` CASCADE`)
+		if err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func withSearchPath(dsn, searchPath string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", searchPath)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+
+	return dsn + " search_path=" + searchPath
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Migrator{db: db, migrations: migrations}
+}
+
+func TestMigratorChecksumMismatch(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	applied, err := newTestMigrator(t, db, testFS()).Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 {
+		t.Fatalf("applied %d migrations, want 3", len(applied))
+	}
+
+	fsys := testFS()
+	fsys["000002_add_widget_name.up.sql"] = &fstest.MapFile{Data: []byte(`ALTER TABLE widgets ADD COLUMN label text`)}
+	fsys["000011_create_gizmos.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE gizmos (id bigserial PRIMARY KEY)`)}
+	modified := newTestMigrator(t, db, fsys)
+
+	statuses, err := modified.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if want := s.Version == 2; s.Modified != want {
+			t.Errorf("migration %d: got modified %t, want %t", s.Version, s.Modified, want)
+		}
+	}
+
+	// Nothing runs, including the new migration, until the change is
+	// resolved.
+	applied, err = modified.Up(ctx)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrChecksumMismatch)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied %d migrations, want none", len(applied))
+	}
+
+	_, err = db.ExecContext(ctx, `SELECT 1 FROM gizmos`)
+	if err == nil {
+		t.Error("the new migration was applied")
+	}
+}
+
+func TestMigratorConvertsLegacyTable(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	// The layout golang-migrate leaves behind, with the first two migrations
+	// already applied by it.
+	for _, query := range []string{
+		`CREATE TABLE schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`,
+		`INSERT INTO schema_migrations (version, dirty) VALUES (2, false)`,
+		`CREATE TABLE widgets (id bigserial PRIMARY KEY, name text)`,
+	} {
+		_, err := db.ExecContext(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, dirty, err := Version(ctx, db)
+	if err != nil || version != 2 || dirty {
+		t.Fatalf("got version %d, dirty %t, error %v, want version 2", version, dirty, err)
+	}
+
+	m := newTestMigrator(t, db, testFS())
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 10 {
+		t.Fatalf("got %+v applied, want only migration 10", applied)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.Modified || s.Unknown {
+			t.Errorf("got status %+v, want every migration applied", s)
+		}
+	}
+
+	version, _, err = Version(ctx, db)
+	if err != nil || version != 10 {
+		t.Errorf("got version %d, error %v after converting, want 10", version, err)
+	}
+
+	// Converted migrations can be reverted like any other.
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 2 || reverted[1].Version != 2 {
+		t.Errorf("got %+v reverted, want migrations 10 and 2", reverted)
+	}
+}
+
+func TestMigratorRefusesDirtyLegacyTable(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	for _, query := range []string{
+		`CREATE TABLE schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`,
+		`INSERT INTO schema_migrations (version, dirty) VALUES (2, true)`,
+	} {
+		_, err := db.ExecContext(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := newTestMigrator(t, db, testFS()).Up(ctx)
+	if !errors.Is(err, ErrDirty) {
+		t.Fatalf("got error %v, want %v", err, ErrDirty)
+	}
+
+	// The legacy table is left for fixing by hand.
+	version, dirty, err := Version(ctx, db)
+	if err != nil || version != 2 || !dirty {
+		t.Errorf("got version %d, dirty %t, error %v, want the dirty legacy version", version, dirty, err)
+	}
+}
@@ -0,0 +1,358 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migrator applies the embedded migrations to a database. Each migration runs
+// in a transaction together with its schema_migrations row, so a failed one
+// leaves nothing behind.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// Status is a migration as this build and the database see it.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the file has changed since it was applied.
+	Modified bool
+	// Unknown is set when the database has a migration this build lacks.
+	Unknown bool
+}
+
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Status lists every migration, applied or not, in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		s := Status{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			s.Modified = a.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, a := range applied {
+		statuses = append(statuses, Status{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Unknown: true})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Up applies every pending migration, returning the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the most recent steps migrations, returning the ones it
+// reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.verified(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err := m.run(ctx, conn, migration, false)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Goto applies or reverts migrations until exactly those up to version are
+// applied. Version 0 reverts everything.
+func (m *Migrator) Goto(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 && !m.known(version) {
+		return nil, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.verified(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+
+			err := m.run(ctx, conn, migration, false)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+
+			err := m.run(ctx, conn, migration, true)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// locked runs fn on a single connection holding the migration advisory lock,
+// after creating or converting the schema_migrations table.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	err = m.prepare(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// prepare creates the schema_migrations table, or replaces one left by
+// golang-migrate, recording every migration up to its version as applied.
+func (m *Migrator) prepare(ctx context.Context, conn *sql.Conn) error {
+	layout, err := tableLayout(ctx, conn)
+	if err != nil || layout == layoutCurrent {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	legacy := 0
+	if layout == layoutLegacy {
+		version, dirty, err := legacyVersion(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("version %d: %w", version, ErrDirty)
+		}
+		legacy = version
+
+		_, err = tx.ExecContext(ctx, `DROP TABLE schema_migrations`)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+	CREATE TABLE schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+	)`
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > legacy {
+			break
+		}
+
+		err := record(ctx, tx, migration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// verified reads the applied migrations, refusing to continue if any have
+// been modified or are unknown to this build.
+func (m *Migrator) verified(ctx context.Context, q queryer) (map[int]Applied, error) {
+	applied, err := m.applied(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	for version, a := range applied {
+		migration, ok := byVersion[version]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("database has migration %d: %w", version, ErrUnknownVersion)
+		case a.Checksum != migration.Checksum:
+			return nil, fmt.Errorf("migration %d: %w", version, ErrChecksumMismatch)
+		}
+	}
+
+	return applied, nil
+}
+
+// applied reads the schema_migrations table in whichever layout it has. A
+// golang-migrate table is taken to mean every migration up to its version
+// was applied unchanged.
+func (m *Migrator) applied(ctx context.Context, q queryer) (map[int]Applied, error) {
+	layout, err := tableLayout(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]Applied)
+
+	switch layout {
+	case layoutMissing:
+		return applied, nil
+	case layoutLegacy:
+		version, dirty, err := legacyVersion(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if dirty {
+			return nil, fmt.Errorf("version %d: %w", version, ErrDirty)
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				applied[migration.Version] = Applied{Version: migration.Version, Name: migration.Name, Checksum: migration.Checksum}
+			}
+		}
+		return applied, nil
+	}
+
+	query := `
+	SELECT version, name, checksum, applied_at
+	FROM schema_migrations
+	ORDER BY version`
+
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Applied
+		err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[a.Version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		_, err = tx.ExecContext(ctx, migration.Up)
+		if err == nil {
+			err = record(ctx, tx, migration)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, migration.Down)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+func record(ctx context.Context, q queryer, migration Migration) error {
+	query := `
+	INSERT INTO schema_migrations (version, name, checksum)
+	VALUES ($1, $2, $3)`
+
+	_, err := q.ExecContext(ctx, query, migration.Version, migration.Name, migration.Checksum)
+	return err
+}
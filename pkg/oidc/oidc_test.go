@@ -0,0 +1,257 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"goproject/pkg/oidc"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+const clientID = "test-client"
+
+// provider is a token endpoint which returns whatever ID token the test
+// signs, so each check in verify can be exercised on its own.
+type provider struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	key     ed25519.PrivateKey
+	idToken func(issuer string) []byte
+	status  int
+}
+
+func newProvider(t *testing.T) *provider {
+	t.Helper()
+
+	p := &provider{key: newKey(t), status: http.StatusOK}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize?prompt=login",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		public := p.key.Public().(ed25519.PublicKey)
+		p.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "OKP", "crv": "Ed25519", "kid": "current", "x": base64.RawURLEncoding.EncodeToString(public)},
+				// Keys the client can't use are skipped.
+				{"kty": "unknown", "kid": "other"},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		status, idToken := p.status, p.idToken
+		p.mu.Unlock()
+
+		if r.PostFormValue("code") != "the-code" || r.PostFormValue("code_verifier") != "the-verifier" {
+			status = http.StatusBadRequest
+		}
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": string(idToken(p.URL))})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// claims returns valid claims for the test client, for a test to spoil.
+func claims(issuer string) *jwt.Claims {
+	now := time.Now()
+
+	c := &jwt.Claims{}
+	c.Issuer = issuer
+	c.Subject = "alice-1"
+	c.Audiences = []string{clientID}
+	c.Issued = jwt.NewNumericTime(now)
+	c.Expires = jwt.NewNumericTime(now.Add(5 * time.Minute))
+	c.KeyID = "current"
+	c.Set = map[string]interface{}{
+		"nonce":          "the-nonce",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+	return c
+}
+
+func (p *provider) issue(t *testing.T, key ed25519.PrivateKey, modify func(c *jwt.Claims)) {
+	t.Helper()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.idToken = func(issuer string) []byte {
+		c := claims(issuer)
+		modify(c)
+
+		token, err := c.EdDSASign(key)
+		if err != nil {
+			t.Error(err)
+		}
+		return token
+	}
+}
+
+func newClient(p *provider) *oidc.Client {
+	return oidc.New(oidc.Config{
+		Name:         "test",
+		Issuer:       p.URL + "/",
+		ClientID:     clientID,
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://localhost/callback",
+	})
+}
+
+func TestExchange(t *testing.T) {
+	p := newProvider(t)
+	p.issue(t, p.key, func(c *jwt.Claims) {})
+
+	client := newClient(p)
+
+	identity, err := client.Exchange(context.Background(), "the-code", "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := oidc.Identity{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *identity != want {
+		t.Errorf("got %+v, want %+v", *identity, want)
+	}
+
+	_, err = client.Exchange(context.Background(), "another-code", "the-verifier", "the-nonce")
+	if !errors.Is(err, oidc.ErrCodeRejected) {
+		t.Errorf("got error %v for a rejected code, want %v", err, oidc.ErrCodeRejected)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	p := newProvider(t)
+	client := newClient(p)
+
+	tests := []struct {
+		name   string
+		key    ed25519.PrivateKey
+		modify func(c *jwt.Claims)
+	}{
+		{"bad signature", newKey(t), func(c *jwt.Claims) {}},
+		{"wrong audience", p.key, func(c *jwt.Claims) { c.Audiences = []string{"another-client"} }},
+		{"no audience", p.key, func(c *jwt.Claims) { c.Audiences = nil }},
+		{"wrong nonce", p.key, func(c *jwt.Claims) { c.Set["nonce"] = "replayed-nonce" }},
+		{"no nonce", p.key, func(c *jwt.Claims) { delete(c.Set, "nonce") }},
+		{"wrong issuer", p.key, func(c *jwt.Claims) { c.Issuer = "https://evil.example.com" }},
+		{"expired", p.key, func(c *jwt.Claims) { c.Expires = jwt.NewNumericTime(time.Now().Add(-time.Minute)) }},
+		{"no subject", p.key, func(c *jwt.Claims) { c.Subject = "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.issue(t, tt.key, tt.modify)
+
+			_, err := client.Exchange(context.Background(), "the-code", "the-verifier", "the-nonce")
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("got error %v, want %v", err, oidc.ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestExchangeRefetchesRotatedKeys(t *testing.T) {
+	p := newProvider(t)
+	p.issue(t, p.key, func(c *jwt.Claims) {})
+
+	client := newClient(p)
+
+	_, err := client.Exchange(context.Background(), "the-code", "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newKey(t)
+	p.mu.Lock()
+	p.key = rotated
+	p.mu.Unlock()
+	p.issue(t, rotated, func(c *jwt.Claims) {})
+
+	_, err = client.Exchange(context.Background(), "the-code", "the-verifier", "the-nonce")
+	if err != nil {
+		t.Errorf("got error %v after the provider rotated its key", err)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p := newProvider(t)
+	client := newClient(p)
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	if challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("challenge %q isn't the S256 hash of the verifier", challenge)
+	}
+
+	authURL, err := client.AuthCodeURL(context.Background(), "the-state", "the-nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := url.Values{
+		"prompt":                {"login"},
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {"http://localhost/callback"},
+		"scope":                 {"openid email profile"},
+		"state":                 {"the-state"},
+		"nonce":                 {"the-nonce"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	if got := u.Query(); got.Encode() != want.Encode() {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+}
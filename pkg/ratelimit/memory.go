@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter keeps state in process. Each replica of the API enforces its
+// limits separately.
+type MemoryLimiter struct {
+	mu  sync.Mutex
+	tat map[string]time.Time
+}
+
+func NewMemory() *MemoryLimiter {
+	return &MemoryLimiter{tat: make(map[string]time.Time)}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tat, res := gcra(time.Now(), l.tat[key], limit)
+	l.tat[key] = tat
+
+	return res, nil
+}
+
+func (l *MemoryLimiter) Sweep(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, tat := range l.tat {
+		if tat.Before(now) {
+			delete(l.tat, key)
+		}
+	}
+
+	return nil
+}
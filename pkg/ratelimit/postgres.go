@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresLimiter keeps state in the rate_limits table, so limits are shared
+// by every replica of the API. The database clock is used throughout so that
+// clock skew between replicas doesn't matter.
+type PostgresLimiter struct {
+	DB *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *PostgresLimiter {
+	return &PostgresLimiter{DB: db}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO rate_limits (key, tat)
+	VALUES ($1, NOW())
+	ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var now, tat time.Time
+
+	err = tx.QueryRowContext(ctx, `
+	SELECT NOW(), tat
+	FROM rate_limits
+	WHERE key = $1
+	FOR UPDATE`, key).Scan(&now, &tat)
+	if err != nil {
+		return Result{}, err
+	}
+
+	next, res := gcra(now, tat, limit)
+
+	if res.Allowed {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limits
+		SET tat = $2
+		WHERE key = $1`, key, next)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	return res, tx.Commit()
+}
+
+func (l *PostgresLimiter) Sweep(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := l.DB.ExecContext(ctx, `
+	DELETE FROM rate_limits
+	WHERE tat < NOW()`)
+	return err
+}
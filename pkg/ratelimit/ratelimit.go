@@ -0,0 +1,78 @@
+// Package ratelimit implements the generic cell rate algorithm (GCRA) over
+// pluggable storage. GCRA needs a single timestamp per key, the theoretical
+// arrival time of the next request, which makes it cheap to keep in a shared
+// database as well as in memory.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Rate requests per second on average, with bursts of up to
+// Burst requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// Result describes the state of a key after a call to Allow.
+type Result struct {
+	Allowed bool
+	// Limit is the burst size, the most requests that can be made at once.
+	Limit int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// ResetAfter is how long until the key is back to its full burst.
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero when Allowed is true.
+	RetryAfter time.Duration
+}
+
+// Limiter counts a request against key and reports whether it is allowed.
+// Sweep forgets keys which are back to their full burst, and should be called
+// periodically.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	Sweep(ctx context.Context) error
+}
+
+// gcra applies one request at now to a key whose theoretical arrival time is
+// tat. It returns the new arrival time to store, which equals tat when the
+// request is refused.
+func gcra(now, tat time.Time, limit Limit) (time.Time, Result) {
+	interval := limit.interval()
+	tolerance := time.Duration(limit.Burst) * interval
+
+	if tat.Before(now) {
+		tat = now
+	}
+
+	res := Result{Limit: limit.Burst}
+
+	next := tat.Add(interval)
+	if wait := next.Sub(now) - tolerance; wait > 0 {
+		res.RetryAfter = wait
+		res.ResetAfter = tat.Sub(now)
+		res.Remaining = remaining(tolerance-tat.Sub(now), interval)
+		return tat, res
+	}
+
+	res.Allowed = true
+	res.ResetAfter = next.Sub(now)
+	res.Remaining = remaining(tolerance-next.Sub(now), interval)
+	return next, res
+}
+
+func remaining(headroom, interval time.Duration) int {
+	if headroom <= 0 {
+		return 0
+	}
+	return int(math.Floor(float64(headroom) / float64(interval)))
+}
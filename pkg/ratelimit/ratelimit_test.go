@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGCRABurstAndRefill(t *testing.T) {
+	// One request a second with bursts of three.
+	limit := Limit{Rate: 1, Burst: 3}
+	now := time.Unix(1000, 0)
+
+	var tat time.Time
+	var res Result
+
+	for i := 0; i < 3; i++ {
+		tat, res = gcra(now, tat, limit)
+		if !res.Allowed {
+			t.Fatalf("request %d refused, want the burst allowed", i+1)
+		}
+		if want := 2 - i; res.Remaining != want {
+			t.Errorf("request %d: got %d remaining, want %d", i+1, res.Remaining, want)
+		}
+	}
+	if res.ResetAfter != 3*time.Second {
+		t.Errorf("got reset after %s, want 3s", res.ResetAfter)
+	}
+
+	next, res := gcra(now, tat, limit)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != time.Second {
+		t.Fatalf("got %+v after the burst, want refused with retry after 1s", res)
+	}
+	if !next.Equal(tat) {
+		t.Error("a refused request changed the stored arrival time")
+	}
+
+	// Just before the next request is due it is still refused.
+	_, res = gcra(now.Add(999*time.Millisecond), tat, limit)
+	if res.Allowed || res.RetryAfter != time.Millisecond {
+		t.Errorf("got %+v, want refused with retry after 1ms", res)
+	}
+
+	// A second later one request has been refilled, and only one.
+	tat, res = gcra(now.Add(time.Second), tat, limit)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("got %+v a second later, want one request allowed", res)
+	}
+
+	_, res = gcra(now.Add(time.Second), tat, limit)
+	if res.Allowed {
+		t.Error("got a second request allowed after a one second refill")
+	}
+
+	// After a long idle period the full burst is back, but no more.
+	later := now.Add(time.Hour)
+	tat, res = gcra(later, tat, limit)
+	if !res.Allowed || res.Remaining != 2 || res.ResetAfter != time.Second {
+		t.Errorf("got %+v after an hour, want a full burst", res)
+	}
+}
+
+func TestGCRAFractionalRate(t *testing.T) {
+	// One request every five seconds, such as the auth route default.
+	limit := Limit{Rate: 0.2, Burst: 1}
+	now := time.Unix(1000, 0)
+
+	tat, res := gcra(now, time.Time{}, limit)
+	if !res.Allowed {
+		t.Fatal("first request refused")
+	}
+
+	_, res = gcra(now.Add(4*time.Second), tat, limit)
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Errorf("got %+v after 4s, want refused with retry after 1s", res)
+	}
+
+	_, res = gcra(now.Add(5*time.Second), tat, limit)
+	if !res.Allowed {
+		t.Errorf("got %+v after 5s, want allowed", res)
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemory()
+	limit := Limit{Rate: 0.01, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		res, err := l.Allow(ctx, "a", limit)
+		if err != nil || !res.Allowed {
+			t.Fatalf("request %d: got %+v, %v, want allowed", i+1, res, err)
+		}
+	}
+
+	res, err := l.Allow(ctx, "a", limit)
+	if err != nil || res.Allowed {
+		t.Fatalf("got %+v, %v, want refused", res, err)
+	}
+
+	// Keys are counted separately.
+	res, err = l.Allow(ctx, "b", limit)
+	if err != nil || !res.Allowed {
+		t.Fatalf("got %+v, %v for another key, want allowed", res, err)
+	}
+
+	// Sweep only forgets keys which are back to their full burst.
+	l.tat["c"] = time.Now().Add(-time.Second)
+
+	err = l.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := l.tat["c"]; ok {
+		t.Error("idle key wasn't swept")
+	}
+	if _, ok := l.tat["a"]; !ok {
+		t.Error("limited key was swept")
+	}
+}
@@ -0,0 +1,141 @@
+// Package realip resolves the address of the client behind any reverse
+// proxies. Forwarding headers are only believed when they were added by a
+// trusted proxy, since anything before that hop is under the client's
+// control.
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// New returns a resolver which trusts proxies in the comma-separated list of
+// CIDR ranges or single addresses. An empty list trusts no proxies, so the
+// connection's peer address is always used.
+func New(spec string) (*Resolver, error) {
+	r := &Resolver{}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+
+		r.trusted = append(r.trusted, network)
+	}
+
+	return r, nil
+}
+
+// ClientIP walks the proxy chain from the nearest hop outwards and returns the
+// first address which isn't a trusted proxy. The Forwarded header is used when
+// present, and X-Forwarded-For otherwise.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	if !r.isTrusted(peer) {
+		return peer
+	}
+
+	var hops []string
+	if forwarded := req.Header.Values("Forwarded"); len(forwarded) > 0 {
+		hops = parseForwarded(forwarded)
+	} else {
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// A malformed or obfuscated hop can't be checked, so stop at the
+			// last proxy we know about.
+			break
+		}
+
+		client = ip.String()
+		if !r.isTrusted(client) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (r *Resolver) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseForwarded extracts the for= address of each element of RFC 7239
+// Forwarded headers, with any quotes, brackets and port removed.
+func parseForwarded(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+
+				val = strings.Trim(val, `"`)
+				if strings.HasPrefix(val, "[") {
+					if end := strings.Index(val, "]"); end > 0 {
+						val = val[1:end]
+					}
+				} else if host, _, err := net.SplitHostPort(val); err == nil {
+					val = host
+				}
+				hop = val
+			}
+
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
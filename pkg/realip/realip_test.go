@@ -0,0 +1,157 @@
+package realip_test
+
+import (
+	"goproject/pkg/realip"
+	"net/http"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	for _, spec := range []string{"", "10.0.0.0/8", "10.0.0.1, 192.168.0.0/16", "::1,fd00::/8"} {
+		_, err := realip.New(spec)
+		if err != nil {
+			t.Errorf("%q: got error %v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{"10.0.0.0/33", "proxy.local", "10.0.0.1,nope"} {
+		_, err := realip.New(spec)
+		if err == nil {
+			t.Errorf("%q: got no error", spec)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trusted   string
+		peer      string
+		xff       []string
+		forwarded []string
+		want      string
+	}{
+		{
+			name: "no proxies trusted",
+			peer: "10.0.0.1:1234",
+			xff:  []string{"203.0.113.7"},
+			want: "10.0.0.1",
+		},
+		{
+			name:    "untrusted peer",
+			trusted: "10.0.0.0/8",
+			peer:    "198.51.100.1:1234",
+			xff:     []string{"203.0.113.7"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "trusted peer without headers",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "trusted peer",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			xff:     []string{"203.0.113.7"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "spoofed hops before the client are ignored",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			xff:     []string{"1.2.3.4, 203.0.113.7"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "chain of trusted proxies",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			xff:     []string{"203.0.113.7, 10.0.0.3", "10.0.0.2"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "untrusted hop in the chain",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			xff:     []string{"203.0.113.7, 198.51.100.9, 10.0.0.2"},
+			want:    "198.51.100.9",
+		},
+		{
+			name:    "every hop trusted",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			xff:     []string{"10.0.0.3, 10.0.0.2"},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "malformed hop",
+			trusted: "10.0.0.0/8",
+			peer:    "10.0.0.1:1234",
+			xff:     []string{"203.0.113.7, garbage, 10.0.0.2"},
+			want:    "10.0.0.2",
+		},
+		{
+			name:      "forwarded",
+			trusted:   "10.0.0.0/8",
+			peer:      "10.0.0.1:1234",
+			forwarded: []string{`for=203.0.113.7;proto=https, for="10.0.0.2:8080"`},
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "forwarded ipv6",
+			trusted:   "10.0.0.0/8",
+			peer:      "10.0.0.1:1234",
+			forwarded: []string{`for="[2001:db8::1]:4711"`},
+			want:      "2001:db8::1",
+		},
+		{
+			name:      "forwarded takes precedence",
+			trusted:   "10.0.0.0/8",
+			peer:      "10.0.0.1:1234",
+			xff:       []string{"198.51.100.9"},
+			forwarded: []string{"for=203.0.113.7"},
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "obfuscated forwarded hop",
+			trusted:   "10.0.0.0/8",
+			peer:      "10.0.0.1:1234",
+			forwarded: []string{"for=203.0.113.7, for=_hidden"},
+			want:      "10.0.0.1",
+		},
+		{
+			name:    "single trusted address",
+			trusted: "::1",
+			peer:    "[::1]:1234",
+			xff:     []string{"203.0.113.7"},
+			want:    "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := realip.New(tt.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.peer
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			for _, v := range tt.forwarded {
+				r.Header.Add("Forwarded", v)
+			}
+
+			if got := resolver.ClientIP(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
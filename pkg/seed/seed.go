@@ -0,0 +1,169 @@
+// Package seed loads the bundled hero dataset, and optionally synthetic
+// players, so a new development database has something to query.
+package seed
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+
+	"goproject/pkg/data"
+	"goproject/pkg/validator"
+)
+
+//go:embed heroes.json
+var heroesJSON []byte
+
+// Dataset is a snapshot of every hero's level 1 stats for one game patch.
+// Version is bumped whenever the file changes.
+type Dataset struct {
+	Version int               `json:"version"`
+	Patch   string            `json:"patch"`
+	Heroes  []*data.Character `json:"heroes"`
+}
+
+// Result counts what a seed run did, so re-running it can be seen to change
+// nothing.
+type Result struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Heroes returns the bundled dataset.
+func Heroes() (*Dataset, error) {
+	var dataset Dataset
+
+	err := json.Unmarshal(heroesJSON, &dataset)
+	if err != nil {
+		return nil, fmt.Errorf("heroes.json: %w", err)
+	}
+
+	return &dataset, nil
+}
+
+// Characters inserts each hero, or updates the character with the same slug
+// if its stats have changed. Heroes without a slug get one from their name.
+func Characters(ctx context.Context, models data.Models, heroes []*data.Character) (Result, error) {
+	var result Result
+
+	for _, hero := range heroes {
+		if hero.Slug == "" {
+			hero.Slug = data.Slugify(hero.Name)
+		}
+
+		v := validator.New()
+		if data.ValidateCharacter(v, hero); !v.Valid() {
+			return result, fmt.Errorf("hero %q: %v", hero.Name, v.Errors)
+		}
+
+		existing, err := models.Characters.GetBySlug(ctx, hero.Slug)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = models.Characters.Insert(ctx, hero)
+			if err != nil {
+				return result, fmt.Errorf("hero %q: %w", hero.Name, err)
+			}
+			result.Inserted++
+			continue
+		case err != nil:
+			return result, fmt.Errorf("hero %q: %w", hero.Name, err)
+		}
+
+		if existing.Name == hero.Name && existing.Health == hero.Health && existing.MoveSpeed == hero.MoveSpeed &&
+			existing.Mana == hero.Mana && slices.Equal(existing.Roles, hero.Roles) {
+			result.Unchanged++
+			continue
+		}
+
+		hero.ID = existing.ID
+		err = models.Characters.Update(ctx, hero)
+		if err != nil {
+			return result, fmt.Errorf("hero %q: %w", hero.Name, err)
+		}
+		result.Updated++
+	}
+
+	return result, nil
+}
+
+var (
+	nicknameAdjectives = []string{"Silent", "Brave", "Lucky", "Swift", "Grim", "Frozen", "Wild", "Arcane", "Iron", "Shadow"}
+	nicknameNouns      = []string{"Ancient", "Roshan", "Courier", "Ward", "Rune", "Creep", "Tower", "Aegis", "Tango", "Blink"}
+	positions          = []string{"Carry", "Mid", "Offlane", "Soft Support", "Hard Support"}
+)
+
+// SyntheticPlayer returns the i'th generated player. The same i always gives
+// the same player, so seeding again updates rather than duplicates them.
+func SyntheticPlayer(i int) *data.Player {
+	r := rand.New(rand.NewSource(int64(i)))
+
+	nickname := fmt.Sprintf("%s%s%03d",
+		nicknameAdjectives[r.Intn(len(nicknameAdjectives))],
+		nicknameNouns[r.Intn(len(nicknameNouns))],
+		i,
+	)
+
+	roles := []string{positions[r.Intn(len(positions))]}
+	if r.Intn(2) == 0 {
+		second := positions[r.Intn(len(positions))]
+		if second != roles[0] {
+			roles = append(roles, second)
+		}
+	}
+
+	return &data.Player{
+		Nickname:     nickname,
+		MMR:          int32(1000 + r.Intn(8000)),
+		WinRate:      int64(40 + r.Intn(21)),
+		TotalMatches: int64(100 + r.Intn(4900)),
+		Roles:        roles,
+	}
+}
+
+// Players inserts or updates the first n synthetic players, matched by
+// nickname.
+func Players(ctx context.Context, models data.Models, n int) (Result, error) {
+	var result Result
+
+	for i := 1; i <= n; i++ {
+		player := SyntheticPlayer(i)
+
+		v := validator.New()
+		if data.ValidatePlayer(v, player); !v.Valid() {
+			return result, fmt.Errorf("player %q: %v", player.Nickname, v.Errors)
+		}
+
+		existing, err := models.Players.GetByNickname(ctx, player.Nickname)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = models.Players.Insert(ctx, player)
+			if err != nil {
+				return result, fmt.Errorf("player %q: %w", player.Nickname, err)
+			}
+			result.Inserted++
+			continue
+		case err != nil:
+			return result, fmt.Errorf("player %q: %w", player.Nickname, err)
+		}
+
+		if existing.MMR == player.MMR && existing.WinRate == player.WinRate &&
+			existing.TotalMatches == player.TotalMatches && slices.Equal(existing.Roles, player.Roles) {
+			result.Unchanged++
+			continue
+		}
+
+		player.PlayerID = existing.PlayerID
+		err = models.Players.Update(ctx, player)
+		if err != nil {
+			return result, fmt.Errorf("player %q: %w", player.Nickname, err)
+		}
+		result.Updated++
+	}
+
+	return result, nil
+}
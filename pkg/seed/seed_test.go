@@ -0,0 +1,202 @@
+package seed_test
+
+import (
+	"context"
+	"errors"
+	"goproject/pkg/data"
+	"goproject/pkg/seed"
+	"slices"
+	"testing"
+)
+
+var errNotImplemented = errors.New("not implemented")
+
+// fakeCharacters and fakePlayers keep copies of what is stored, so the seed
+// functions can't change stored rows except through the models.
+type fakeCharacters struct {
+	rows []data.Character
+}
+
+func (f *fakeCharacters) Insert(ctx context.Context, character *data.Character) error {
+	character.ID = int64(len(f.rows) + 1)
+	row := *character
+	row.Roles = slices.Clone(character.Roles)
+	f.rows = append(f.rows, row)
+	return nil
+}
+
+func (f *fakeCharacters) GetBySlug(ctx context.Context, slug string) (*data.Character, error) {
+	for _, row := range f.rows {
+		if row.Slug == slug {
+			row.Roles = slices.Clone(row.Roles)
+			return &row, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (f *fakeCharacters) Update(ctx context.Context, character *data.Character) error {
+	row := *character
+	row.Roles = slices.Clone(character.Roles)
+	f.rows[character.ID-1] = row
+	return nil
+}
+
+func (f *fakeCharacters) Get(ctx context.Context, id int64) (*data.Character, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeCharacters) Upsert(ctx context.Context, character *data.Character) (bool, error) {
+	return false, errNotImplemented
+}
+
+func (f *fakeCharacters) Delete(ctx context.Context, id int64) error {
+	return errNotImplemented
+}
+
+func (f *fakeCharacters) GetAll(ctx context.Context, name string, roles []string, filters data.Filters) ([]*data.Character, data.Metadata, error) {
+	return nil, data.Metadata{}, errNotImplemented
+}
+
+type fakePlayers struct {
+	rows []data.Player
+}
+
+func (f *fakePlayers) Insert(ctx context.Context, player *data.Player) error {
+	player.PlayerID = int64(len(f.rows) + 1)
+	row := *player
+	row.Roles = slices.Clone(player.Roles)
+	f.rows = append(f.rows, row)
+	return nil
+}
+
+func (f *fakePlayers) GetByNickname(ctx context.Context, nickname string) (*data.Player, error) {
+	for _, row := range f.rows {
+		if row.Nickname == nickname {
+			row.Roles = slices.Clone(row.Roles)
+			return &row, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (f *fakePlayers) Update(ctx context.Context, player *data.Player) error {
+	row := *player
+	row.Roles = slices.Clone(player.Roles)
+	f.rows[player.PlayerID-1] = row
+	return nil
+}
+
+func (f *fakePlayers) Get(ctx context.Context, id int64) (*data.Player, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakePlayers) Delete(ctx context.Context, id int64) error {
+	return errNotImplemented
+}
+
+func (f *fakePlayers) GetAll(ctx context.Context, nickname string, roles []string, filters data.Filters) ([]*data.Player, data.Metadata, error) {
+	return nil, data.Metadata{}, errNotImplemented
+}
+
+func newModels() data.Models {
+	return data.Models{Characters: &fakeCharacters{}, Players: &fakePlayers{}}
+}
+
+func heroes(t *testing.T) []*data.Character {
+	t.Helper()
+
+	dataset, err := seed.Heroes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dataset.Version < 1 || dataset.Patch == "" || len(dataset.Heroes) == 0 {
+		t.Fatalf("got dataset version %d, patch %q with %d heroes", dataset.Version, dataset.Patch, len(dataset.Heroes))
+	}
+
+	return dataset.Heroes
+}
+
+func TestCharacters(t *testing.T) {
+	ctx := context.Background()
+	models := newModels()
+
+	first := heroes(t)
+
+	result, err := seed.Characters(ctx, models, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (seed.Result{Inserted: len(first)}) {
+		t.Fatalf("got %+v from the first run, want %d inserted", result, len(first))
+	}
+
+	// Running again changes nothing.
+	result, err = seed.Characters(ctx, models, heroes(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (seed.Result{Unchanged: len(first)}) {
+		t.Fatalf("got %+v from the second run, want all %d unchanged", result, len(first))
+	}
+
+	// A changed stat, such as from a new patch, updates only that hero.
+	patched := heroes(t)
+	patched[0].Health += 20
+
+	result, err = seed.Characters(ctx, models, patched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (seed.Result{Updated: 1, Unchanged: len(first) - 1}) {
+		t.Fatalf("got %+v after a patch, want one updated", result)
+	}
+
+	stored := models.Characters.(*fakeCharacters).rows
+	if len(stored) != len(first) || stored[0].Health != patched[0].Health {
+		t.Errorf("got %d characters with health %d, want %d with %d", len(stored), stored[0].Health, len(first), patched[0].Health)
+	}
+}
+
+func TestCharactersRejectsInvalidHeroes(t *testing.T) {
+	models := newModels()
+
+	hero := heroes(t)[0]
+	hero.Roles = nil
+
+	_, err := seed.Characters(context.Background(), models, []*data.Character{hero})
+	if err == nil {
+		t.Fatal("got no error for a hero without roles")
+	}
+	if len(models.Characters.(*fakeCharacters).rows) != 0 {
+		t.Error("an invalid hero was stored")
+	}
+}
+
+func TestPlayers(t *testing.T) {
+	ctx := context.Background()
+	models := newModels()
+
+	// Generated players are stable.
+	a, b := seed.SyntheticPlayer(7), seed.SyntheticPlayer(7)
+	if a.Nickname != b.Nickname || a.MMR != b.MMR || !slices.Equal(a.Roles, b.Roles) {
+		t.Errorf("got %+v and %+v for the same player", a, b)
+	}
+
+	result, err := seed.Players(ctx, models, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (seed.Result{Inserted: 25}) {
+		t.Fatalf("got %+v from the first run, want 25 inserted", result)
+	}
+
+	result, err = seed.Players(ctx, models, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (seed.Result{Inserted: 5, Unchanged: 25}) {
+		t.Fatalf("got %+v from the second run, want 5 inserted and 25 unchanged", result)
+	}
+}